@@ -0,0 +1,122 @@
+package context
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Done关了不等于活真的停了。 优雅关停的时候要等干活的协程自己说一声"我停了"
+// 取消的一方: ctx, a := WithAck(parent); ... a.CancelAndWait(5*time.Second)
+// 干活的一方: w := RegisterWorker(ctx); defer w.Ack()
+
+// ErrAckTimeout CancelAndWait等到超时还有worker没有Ack
+var ErrAckTimeout = errors.New("context: workers did not acknowledge cancel in time")
+
+// WithAck 和WithCancel一样。 只是取消的一方可以等登记在它下面的worker全部Ack
+func WithAck(parent Context) (Context, *AckCancel) {
+	if parent == nil {
+		panic("cannot create context from nil parent")
+	}
+	c := &ackCtx{}
+	c.cancelCtx.propagateCancel(parent, c)
+	return c, &AckCancel{c}
+}
+
+// AckCancel WithAck返回的取消的一方
+type AckCancel struct {
+	c *ackCtx
+}
+
+// Cancel 只取消。 不等
+func (a *AckCancel) Cancel() {
+	a.c.cancel(true, Canceled, nil)
+}
+
+// CancelAndWait 取消。 然后等所有登记过的worker都Ack
+// 都Ack了返回nil。 等了timeout还有没Ack的返回ErrAckTimeout
+func (a *AckCancel) CancelAndWait(timeout time.Duration) error {
+	a.c.cancel(true, Canceled, nil)
+	a.c.mu.Lock()
+	if a.c.pending == 0 {
+		a.c.mu.Unlock()
+		return nil
+	}
+	if a.c.idle == nil {
+		a.c.idle = make(chan struct{})
+	}
+	idle := a.c.idle
+	a.c.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-idle:
+		return nil
+	case <-timer.C:
+		return ErrAckTimeout
+	}
+}
+
+// Worker RegisterWorker给的凭证。 活停下来了就调Ack
+type Worker struct {
+	once sync.Once
+	acks []*ackCtx
+}
+
+// RegisterWorker 在ctx上面所有的WithAck那里登记一个worker。 外面的CancelAndWait也会等它
+// 上面没有WithAck的话。 给一个什么都不做的Worker
+func RegisterWorker(ctx Context) *Worker {
+	w := &Worker{}
+	for a, ok := ctx.Value(&ackKey).(*ackCtx); ok; a, ok = a.cancelCtx.parent().Value(&ackKey).(*ackCtx) {
+		a.mu.Lock()
+		a.pending++
+		a.mu.Unlock()
+		w.acks = append(w.acks, a)
+	}
+	return w
+}
+
+// Ack 告诉取消的一方这个worker已经停了。 调多次只算一次
+func (w *Worker) Ack() {
+	w.once.Do(func() {
+		for _, a := range w.acks {
+			a.mu.Lock()
+			a.pending--
+			if a.pending == 0 && a.idle != nil {
+				close(a.idle)
+				a.idle = nil
+			}
+			a.mu.Unlock()
+		}
+	})
+}
+
+// &ackKey 是ackCtx返回自己用的key。 和cancelCtxKey一个道理
+var ackKey int
+
+// ackCtx 是对cancelCtx的继承。 多了一个worker计数
+type ackCtx struct {
+	cancelCtx
+	pending int           // workers registered but not acked, under cancelCtx.mu
+	idle    chan struct{} // closed when pending drops to zero, under cancelCtx.mu
+}
+
+func (c *ackCtx) Value(key any) any {
+	if key == &ackKey {
+		return c
+	}
+	return c.cancelCtx.Value(key)
+}
+
+func (c *ackCtx) String() string {
+	return contextName(c.cancelCtx.parent()) + ".WithAck"
+}
+
+func (c *ackCtx) cancel(removeFromParent bool, err, cause error) bool {
+	canceled := c.cancelCtx.cancel(false, err, cause)
+	if removeFromParent {
+		removeChild(c.cancelCtx.parent(), c)
+	}
+	return canceled
+}
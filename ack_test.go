@@ -0,0 +1,37 @@
+package context
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCancelAndWaitThroughFilterValues(t *testing.T) {
+	ctx, a := WithAck(Background())
+	filtered := FilterValues(ctx, func(any) bool { return false })
+	w := RegisterWorker(filtered)
+
+	acked := make(chan struct{})
+	go func() {
+		<-filtered.Done()
+		time.Sleep(10 * time.Millisecond)
+		close(acked)
+		w.Ack()
+	}()
+	if err := a.CancelAndWait(5 * time.Second); err != nil {
+		t.Fatalf("CancelAndWait = %v, want nil", err)
+	}
+	select {
+	case <-acked:
+	default:
+		t.Fatal("CancelAndWait returned before the worker behind FilterValues acked")
+	}
+}
+
+func TestCancelAndWaitTimeout(t *testing.T) {
+	ctx, a := WithAck(Background())
+	w := RegisterWorker(ctx)
+	defer w.Ack()
+	if err := a.CancelAndWait(10 * time.Millisecond); err != ErrAckTimeout {
+		t.Fatalf("CancelAndWait = %v, want %v", err, ErrAckTimeout)
+	}
+}
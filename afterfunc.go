@@ -0,0 +1,246 @@
+package context
+
+import (
+	"sync"
+)
+
+// afterfunc 执行stop函数 主动停止context。再执行这个函数
+func AfterFunc(ctx Context, f func()) (stop func() bool) {
+	a := &afterFuncCtx{
+		f: f,
+	}
+	a.cancelCtx.propagateCancel(ctx, a)
+	return func() bool {
+		stopped := false
+		a.once.Do(func() {
+			stopped = true
+		})
+		if stopped {
+			a.cancel(true, Canceled, nil)
+		}
+		return stopped
+	}
+}
+
+// AfterFuncCause 和AfterFunc一样。 只是f能拿到ctx结束的原因
+// 是Canceled 还是DeadlineExceeded 还是自己给的cause。 f里面不用再去问ctx
+func AfterFuncCause(ctx Context, f func(cause error)) (stop func() bool) {
+	return AfterFunc(ctx, func() {
+		// f跑的时候ctx一定已经结束了。 这时候取的就是最后的原因
+		f(Cause(ctx))
+	})
+}
+
+// AfterFuncSync 和AfterFunc一样。 只是f不另开协程。 直接在执行取消的那个协程上跑
+// cancel函数返回的时候f已经跑完了。 同一个ctx上注册的几个f按注册的顺序跑。 拆东西的顺序就是确定的
+// f跑的时候ctx自己的锁已经放了。 但如果是祖先取消连带的。 祖先的锁还拿着。 所以f里面不要去碰ctx的祖先
+// ctx背后没有cancelCtx的话(别人自己实现的ctx)。 只能退回到AfterFunc
+func AfterFuncSync(ctx Context, f func()) (stop func() bool) {
+	if ctx.Done() != nil && ctx.Err() != nil {
+		f()
+		return func() bool { return false }
+	}
+	c, ok := parentCancelCtx(ctx)
+	if !ok {
+		return AfterFunc(ctx, f)
+	}
+	s := &syncFunc{f: f}
+	c.mu.Lock()
+	if c.Err() != nil {
+		c.mu.Unlock()
+		s.run()
+		return func() bool { return false }
+	}
+	c.syncFuncs = append(c.syncFuncs, s)
+	c.mu.Unlock()
+	return func() bool {
+		stopped := false
+		s.once.Do(func() {
+			stopped = true
+		})
+		if stopped {
+			c.mu.Lock()
+			for i, o := range c.syncFuncs {
+				if o == s {
+					c.syncFuncs = append(c.syncFuncs[:i], c.syncFuncs[i+1:]...)
+					break
+				}
+			}
+			c.mu.Unlock()
+		}
+		return stopped
+	}
+}
+
+type syncFunc struct {
+	once sync.Once // either runs f or stops f from running
+	f    func()
+}
+
+func (s *syncFunc) run() {
+	s.once.Do(s.f)
+}
+
+// 定义这个是为了让 ctx融合的时候。断言parent ctx的类型，好让子ctx能继承parentctx的func
+type afterFuncer interface {
+	AfterFunc(func()) func() bool
+}
+
+type afterFuncCtx struct {
+	cancelCtx
+	once sync.Once // either starts running f or stops f from running
+	f    func()
+}
+
+// cancel 父子分离 执行函数
+func (a *afterFuncCtx) cancel(removeFromParent bool, err, cause error) bool {
+	canceled := a.cancelCtx.cancel(false, err, cause)
+	if removeFromParent {
+		removeChild(a.parent(), a)
+	}
+	a.once.Do(func() {
+		afterFuncs.run(a.f)
+	})
+	return canceled
+}
+
+// afterFuncPool 控制afterfunc同时跑多少个
+// 大量ctx一起取消的时候。 每个afterfunc都go一下。 协程数量就没边了
+// limit<=0 就是不限制。 和原来一样直接go
+type afterFuncPool struct {
+	mu      sync.Mutex
+	limit   int
+	running int
+	queue   []func()
+}
+
+var afterFuncs afterFuncPool
+
+// SetAfterFuncConcurrency 最多同时跑n个afterfunc。 多出来的排队。 n<=0 不限制
+func SetAfterFuncConcurrency(n int) {
+	afterFuncs.mu.Lock()
+	afterFuncs.limit = n
+	afterFuncs.mu.Unlock()
+}
+
+func (p *afterFuncPool) run(f func()) {
+	p.mu.Lock()
+	if p.limit <= 0 {
+		p.mu.Unlock()
+		go f()
+		return
+	}
+	// 满了就排队。 只是往切片里加。 不会阻塞
+	// 所以afterfunc里面再去取消别的ctx也不会死锁
+	if p.running >= p.limit {
+		p.queue = append(p.queue, f)
+		p.mu.Unlock()
+		return
+	}
+	p.running++
+	p.mu.Unlock()
+	go p.work(f)
+}
+
+// work 跑完手上的。 再去队列里拿。 队列空了就退出
+func (p *afterFuncPool) work(f func()) {
+	for f != nil {
+		f()
+		p.mu.Lock()
+		if len(p.queue) > 0 {
+			f = p.queue[0]
+			p.queue[0] = nil
+			p.queue = p.queue[1:]
+		} else {
+			f = nil
+			p.running--
+		}
+		p.mu.Unlock()
+	}
+}
+
+// OnCancel ctx取消之后跑fn。 注册了好几个的话。 倒着跑。 后注册的先跑。 和defer一样
+// 所有的fn在同一个协程里一个一个跑。 用WaitCleanup等它们跑完
+// 返回的remove把fn撤掉。 已经开始跑了的话就撤不掉了
+// ctx已经取消了的话。 fn当场就跑。 ctx永远不会取消的话。 fn永远不跑
+// 背后没有cancelCtx的(别人自己实现的ctx)。 每个fn单独用AfterFunc盯着。 这种不保证倒着跑。 WaitCleanup也等不到它们
+func OnCancel(ctx Context, fn func()) (remove func()) {
+	c, ok := ctx.Value(&cancelCtxKey).(*cancelCtx)
+	if !ok {
+		if ctx.Done() == nil {
+			return func() {}
+		}
+		stop := AfterFunc(ctx, fn)
+		return func() { stop() }
+	}
+	c.mu.Lock()
+	if c.Err() != nil {
+		c.mu.Unlock()
+		fn()
+		return func() {}
+	}
+	l := c.cleanup
+	first := l == nil
+	if first {
+		l = &cleanupList{done: make(chan struct{})}
+		c.cleanup = l
+	}
+	e := &fn
+	l.fns = append(l.fns, e)
+	c.mu.Unlock()
+	if first {
+		AfterFunc(ctx, func() { l.run(c) })
+	}
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if l.started {
+			return
+		}
+		for i, o := range l.fns {
+			if o == e {
+				l.fns = append(l.fns[:i], l.fns[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// WaitCleanup 等ctx取消。 再等OnCancel注册的fn全部跑完
+// ctx永远不会取消的话直接返回。 不然就一直卡着了
+func WaitCleanup(ctx Context) {
+	done := ctx.Done()
+	if done == nil {
+		return
+	}
+	<-done
+	c, ok := ctx.Value(&cancelCtxKey).(*cancelCtx)
+	if !ok {
+		return
+	}
+	c.mu.Lock()
+	l := c.cleanup
+	c.mu.Unlock()
+	if l != nil {
+		<-l.done
+	}
+}
+
+// cleanupList 一个cancelCtx上OnCancel注册的所有fn。 字段都由cancelCtx的mu保护。 done除外
+type cleanupList struct {
+	fns     []*func()
+	started bool
+	done    chan struct{} // closed once every fn has returned
+}
+
+func (l *cleanupList) run(c *cancelCtx) {
+	c.mu.Lock()
+	l.started = true
+	fns := l.fns
+	l.fns = nil
+	c.mu.Unlock()
+	defer close(l.done)
+	for i := len(fns) - 1; i >= 0; i-- {
+		(*fns[i])()
+	}
+}
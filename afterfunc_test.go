@@ -0,0 +1,168 @@
+package context
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAfterFuncConcurrency(t *testing.T) {
+	SetAfterFuncConcurrency(1)
+	defer SetAfterFuncConcurrency(0)
+
+	var running, maxRunning atomic.Int32
+	var wg sync.WaitGroup
+	slow := func() {
+		defer wg.Done()
+		n := running.Add(1)
+		if n > maxRunning.Load() {
+			maxRunning.Store(n)
+		}
+		time.Sleep(10 * time.Millisecond)
+		running.Add(-1)
+	}
+	a, cancelA := WithCancel(Background())
+	b, cancelB := WithCancel(Background())
+	wg.Add(2)
+	AfterFunc(a, slow)
+	AfterFunc(b, slow)
+	cancelA()
+	cancelB()
+	wg.Wait()
+	if n := maxRunning.Load(); n != 1 {
+		t.Fatalf("%d after-funcs ran at once, want 1", n)
+	}
+
+	// 回调里再取消别的ctx。 那个ctx的回调排在后面。 不能卡死
+	c, cancelC := WithCancel(Background())
+	d, cancelD := WithCancel(Background())
+	done := make(chan struct{})
+	AfterFunc(c, cancelD)
+	AfterFunc(d, func() { close(done) })
+	cancelC()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("after-func canceling another ctx deadlocked the pool")
+	}
+}
+
+func TestOnCancelOrder(t *testing.T) {
+	ctx, cancel := WithCancel(Background())
+	var mu sync.Mutex
+	var got []int
+	for i := range 3 {
+		OnCancel(ctx, func() {
+			mu.Lock()
+			got = append(got, i)
+			mu.Unlock()
+		})
+	}
+	remove := OnCancel(ctx, func() { t.Error("removed fn ran") })
+	remove()
+	cancel()
+	WaitCleanup(ctx)
+
+	// 和defer一样。 后注册的先跑
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 3 || got[0] != 2 || got[1] != 1 || got[2] != 0 {
+		t.Errorf("ran in order %v, want [2 1 0]", got)
+	}
+}
+
+func TestWaitCleanup(t *testing.T) {
+	ctx, cancel := WithCancel(Background())
+	var finished atomic.Bool
+	OnCancel(ctx, func() {
+		time.Sleep(20 * time.Millisecond)
+		finished.Store(true)
+	})
+	cancel()
+	WaitCleanup(ctx)
+	if !finished.Load() {
+		t.Error("WaitCleanup returned before the fn finished")
+	}
+
+	// 已经取消了的。 当场就跑
+	ran := false
+	OnCancel(ctx, func() { ran = true })
+	if !ran {
+		t.Error("OnCancel on a canceled ctx did not run fn")
+	}
+	// 永远不会取消的。 直接返回
+	WaitCleanup(Background())
+}
+
+// chanCtx 别人自己实现的ctx。 背后没有cancelCtx
+type chanCtx struct {
+	done chan struct{}
+}
+
+func (c *chanCtx) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (c *chanCtx) Done() <-chan struct{}       { return c.done }
+func (c *chanCtx) Value(key any) any           { return nil }
+func (c *chanCtx) Err() error {
+	select {
+	case <-c.done:
+		return Canceled
+	default:
+		return nil
+	}
+}
+
+func TestOnCancelCustomContext(t *testing.T) {
+	ctx := &chanCtx{done: make(chan struct{})}
+	ran := make(chan struct{})
+	OnCancel(ctx, func() { close(ran) })
+	remove := OnCancel(ctx, func() { t.Error("removed fn ran") })
+	remove()
+	close(ctx.done)
+	select {
+	case <-ran:
+	case <-time.After(5 * time.Second):
+		t.Fatal("fn never ran after a custom ctx was canceled")
+	}
+}
+
+func TestAfterFuncSync(t *testing.T) {
+	ctx, cancel := WithCancel(Background())
+	c := ctx.(*cancelCtx)
+	var got []int
+	for i := range 3 {
+		AfterFuncSync(ctx, func() {
+			// 自己的锁已经放了
+			if !c.mu.TryLock() {
+				t.Errorf("fn %d runs while the ctx lock is held", i)
+			} else {
+				c.mu.Unlock()
+			}
+			if ctx.Err() == nil {
+				t.Errorf("fn %d runs before Err() is set", i)
+			}
+			got = append(got, i)
+		})
+	}
+	stop := AfterFuncSync(ctx, func() { t.Error("stopped fn ran") })
+	if !stop() {
+		t.Fatal("stop() = false, want true")
+	}
+
+	cancel()
+	// cancel返回的时候已经按注册的顺序跑完了。 没有别的协程
+	if !slices.Equal(got, []int{0, 1, 2}) {
+		t.Fatalf("ran %v by the time cancel returned, want [0 1 2]", got)
+	}
+	if stop() {
+		t.Error("second stop() = true, want false")
+	}
+
+	// 已经取消了的。 当场跑
+	ran := false
+	AfterFuncSync(ctx, func() { ran = true })
+	if !ran {
+		t.Error("AfterFuncSync on a canceled ctx did not run f")
+	}
+}
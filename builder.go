@@ -0,0 +1,141 @@
+package context
+
+import (
+	"strings"
+	"time"
+)
+
+// Builder 一次把超时、值、名字都配好。 Build的时候只建一个节点
+// 每个请求都要 WithTimeout + WithValue + WithName 的话。 就是三个节点三次分配。 查值还要一层层跳
+// 用法: New(parent).WithTimeout(d).WithValue(k, v).WithName("x").Build()
+// 一个Builder只Build一次。 Build之后不要再往里加东西
+type Builder struct {
+	parent   Context
+	timed    bool
+	timeout  time.Duration // used when deadline is zero
+	deadline time.Time
+	kv       []any // key1, val1, key2, val2 ...
+	name     string
+}
+
+// New 开始配一个挂在parent下面的ctx
+func New(parent Context) *Builder {
+	if parent == nil {
+		panic("cannot create context from nil parent")
+	}
+	return &Builder{parent: parent}
+}
+
+// WithTimeout 从Build那一刻开始算。 和WithDeadline只有一个算数。 后调的算
+func (b *Builder) WithTimeout(d time.Duration) *Builder {
+	b.timed, b.timeout, b.deadline = true, d, time.Time{}
+	return b
+}
+
+// WithDeadline 和WithTimeout只有一个算数。 后调的算
+func (b *Builder) WithDeadline(d time.Time) *Builder {
+	b.timed, b.timeout, b.deadline = true, 0, d
+	return b
+}
+
+// WithValue 和WithValue(parent, key, val)一样的检查。 同一个key存好几次的话后面的算数
+func (b *Builder) WithValue(key, val any) *Builder {
+	checkKey(key)
+	if vc, ok := val.(Context); ok && isAncestor(vc, b.parent) {
+		panic("context stored as a value of itself or its descendant")
+	}
+	b.kv = append(b.kv, key, val)
+	return b
+}
+
+// WithName 和WithName(parent, name)一样
+func (b *Builder) WithName(name string) *Builder {
+	b.name = name
+	return b
+}
+
+// Build 建出ctx。 不管配没配超时都能取消
+func (b *Builder) Build() (Context, CancelFunc) {
+	c := &builtCtx{kv: b.kv, name: b.name}
+	d := b.deadline
+	if b.timed && d.IsZero() {
+		d = time.Now().Add(b.timeout)
+	}
+	// parent的截止日期更早或者一样。 和WithDeadline一样不用自己计时
+	if cur, ok := b.parent.Deadline(); b.timed && (!ok || cur.After(d)) {
+		c.own = true
+		c.deadline = d
+	}
+	c.cancelCtx.propagateCancel(b.parent, c)
+	if !c.own {
+		return c, func() { c.cancel(true, Canceled, nil) }
+	}
+	dur := time.Until(d)
+	if dur <= 0 {
+		c.cancel(true, DeadlineExceeded, nil) // deadline has already passed
+		return c, func() { c.cancel(false, Canceled, nil) }
+	}
+	c.mu.Lock()
+	if c.Err() == nil {
+		c.timer = afterFunc(dur, func() {
+			c.cancel(true, DeadlineExceeded, nil)
+		})
+	}
+	c.mu.Unlock()
+	return c, func() { c.cancel(true, Canceled, nil) }
+}
+
+// builtCtx 是对timerCtx的继承。 值和名字也放在同一个节点里
+type builtCtx struct {
+	timerCtx
+	own  bool  // has its own deadline and timer
+	kv   []any // key1, val1, key2, val2 ...
+	name string
+}
+
+// 没配超时就是parent的截止日期
+func (c *builtCtx) Deadline() (deadline time.Time, ok bool) {
+	if c.own {
+		return c.timerCtx.Deadline()
+	}
+	return c.cancelCtx.parent().Deadline()
+}
+
+// 从后往前找。 后存的先找到
+// 存进来的key都能比较。 所以拿别的key来==不会panic
+func (c *builtCtx) Value(key any) any {
+	if key == &cancelCtxKey {
+		return &c.cancelCtx
+	}
+	for i := len(c.kv) - 2; i >= 0; i -= 2 {
+		if c.kv[i] == key {
+			hookLookup(c, key, true)
+			return c.kv[i+1]
+		}
+	}
+	return value(c.cancelCtx.parent(), key)
+}
+
+// 起了名字就和WithName一样显示。 没起名字就把配了什么列出来
+func (c *builtCtx) String() string {
+	if c.name != "" {
+		return c.name + "(" + shortName(c.cancelCtx.parent()) + ")"
+	}
+	var parts []string
+	if c.own {
+		d, _ := c.Deadline()
+		parts = append(parts, d.String())
+	}
+	for i := 0; i < len(c.kv); i += 2 {
+		parts = append(parts, keyString(c.kv[i]))
+	}
+	return contextName(c.cancelCtx.parent()) + ".Build(" + strings.Join(parts, ", ") + ")"
+}
+
+func (c *builtCtx) cancel(removeFromParent bool, err, cause error) bool {
+	canceled := c.timerCtx.cancel(false, err, cause)
+	if removeFromParent {
+		removeChild(c.cancelCtx.parent(), c)
+	}
+	return canceled
+}
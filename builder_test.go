@@ -0,0 +1,97 @@
+package context
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBuilder(t *testing.T) {
+	parent, cancelParent := WithCancel(WithValue(Background(), "p", "parent"))
+	defer cancelParent()
+	d := time.Now().Add(time.Hour)
+	ctx, cancel := New(parent).
+		WithValue("a", 1).
+		WithTimeout(time.Minute).
+		WithValue("b", 2).
+		WithDeadline(d). // 后调的算
+		WithValue("a", 3).
+		WithName("req").
+		Build()
+	defer cancel()
+
+	// 同一个key后存的算数。 没存的去parent找
+	for key, want := range map[string]any{"a": 3, "b": 2, "p": "parent", "nope": nil} {
+		if got := ctx.Value(key); got != want {
+			t.Errorf("Value(%q) = %v, want %v", key, got, want)
+		}
+	}
+	if got, ok := ctx.Deadline(); !ok || !got.Equal(d) {
+		t.Errorf("Deadline() = %v, %v, want %v, true", got, ok, d)
+	}
+	// 子ctx打印出来用名字
+	if got := contextName(ctx); got != "req" {
+		t.Errorf("contextName = %q, want req", got)
+	}
+	if got := parentOf(ctx); got != parent {
+		t.Errorf("parent = %v, want %v", got, parent)
+	}
+
+	cancel()
+	if err := ctx.Err(); err != Canceled {
+		t.Errorf("Err() after cancel = %v, want %v", err, Canceled)
+	}
+	if ctx.(*builtCtx).timer != nil {
+		t.Error("timer still armed after cancel")
+	}
+}
+
+func TestBuilderTimeout(t *testing.T) {
+	// 后调的WithTimeout把前面的WithDeadline盖掉
+	ctx, cancel := New(Background()).WithDeadline(time.Now().Add(time.Hour)).WithTimeout(time.Millisecond).Build()
+	defer cancel()
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("built ctx never timed out")
+	}
+	if err := ctx.Err(); err != DeadlineExceeded {
+		t.Errorf("Err() = %v, want %v", err, DeadlineExceeded)
+	}
+
+	// 截止日期已经过了
+	ctx, cancel = New(Background()).WithDeadline(time.Now().Add(-time.Second)).Build()
+	defer cancel()
+	if err := ctx.Err(); err != DeadlineExceeded {
+		t.Errorf("past deadline: Err() = %v, want %v", err, DeadlineExceeded)
+	}
+
+	// parent更早到期就用parent的。 自己不计时。 parent到期连带取消
+	parent, cancelParent := WithTimeout(Background(), 10*time.Millisecond)
+	defer cancelParent()
+	want, _ := parent.Deadline()
+	ctx, cancel = New(parent).WithTimeout(time.Hour).WithValue("k", 1).Build()
+	defer cancel()
+	if got, ok := ctx.Deadline(); !ok || !got.Equal(want) {
+		t.Errorf("Deadline() = %v, %v, want the parent's %v", got, ok, want)
+	}
+	if ctx.(*builtCtx).timer != nil {
+		t.Error("built ctx armed its own timer under an earlier parent deadline")
+	}
+	<-ctx.Done()
+	if err := ctx.Err(); err != DeadlineExceeded {
+		t.Errorf("Err() at the parent deadline = %v, want %v", err, DeadlineExceeded)
+	}
+
+	// 没配超时也能取消。 没有截止日期
+	ctx, cancel = New(Background()).WithValue("k", 1).Build()
+	if got := ctx.(stringer).String(); got != "context.Background.Build(k)" {
+		t.Errorf("String() = %q, want context.Background.Build(k)", got)
+	}
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("Build without a timeout has a deadline")
+	}
+	cancel()
+	if err := ctx.Err(); err != Canceled {
+		t.Errorf("Err() after cancel = %v, want %v", err, Canceled)
+	}
+}
@@ -0,0 +1,927 @@
+package context
+
+import (
+	"errors"
+	"io"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CancelFunc
+// 4.CancelFunc 取消函数是一个类型
+type CancelFunc func()
+type CancelCauseFunc func(cause error)
+
+func WithCancel(parent Context) (ctx Context, cancel CancelFunc) {
+	// 设想一下 parent是最顶端的。他返回了一个context。那么只能是他的子context了
+	// 以及往取消这个子context的函数
+	// 所以这个功能是声明一个带取消功能的context对象
+	c := withCancel(parent)
+	// 连接器没有cancel功能。就自己往cancelcontext对象添加傻瓜式cancel功能。上层执行cancel
+	// 下面就执行 cancel(true,canceld.nil)
+	return c, func() { c.cancel(true, Canceled, nil) }
+}
+
+// WithCancelCause只是将心脏。也就是取消的那个函数多接收一个cause
+func WithCancelCause(parent Context) (ctx Context, cancel CancelCauseFunc) {
+	c := withCancel(parent)
+	return c, func(cause error) { c.cancel(true, Canceled, cause) }
+}
+
+// WithCancelCause2 和WithCancelCause一样。 多给一个cause函数
+// 拿着取消那一边的代码。 用它就能看到最后真正生效的是哪个原因(自己的还是parent的)。 没取消返回nil
+// 不会阻塞。 不用去翻Value(&cancelCtxKey)
+func WithCancelCause2(parent Context) (ctx Context, cancel CancelCauseFunc, cause func() error) {
+	c := withCancel(parent)
+	return c, func(cause error) { c.cancel(true, Canceled, cause) }, func() error {
+		return c.loadCause()
+	}
+}
+
+// WithCancelCauses 取消的时候可以给好几个原因。 用errors.Join合成一个cause
+// errors.Is 能匹配上其中任何一个。 一个原因都不给就和普通取消一样是Canceled
+func WithCancelCauses(parent Context) (ctx Context, cancel func(causes ...error)) {
+	c := withCancel(parent)
+	return c, func(causes ...error) { c.cancel(true, Canceled, errors.Join(causes...)) }
+}
+
+// WithCancelChan 用外面给的done当这个ctx的Done()。 不再自己懒创建
+// 取消函数和parent取消都会把done关掉。 只会关一次
+// done交进来之后就归这个ctx管了。 外面不要再自己close它。 不然取消的时候会panic
+func WithCancelChan(parent Context, done chan struct{}) (ctx Context, cancel CancelFunc) {
+	if parent == nil {
+		panic("cannot create context from nil parent")
+	}
+	if done == nil {
+		panic("nil done channel")
+	}
+	c := &cancelCtx{}
+	c.done.Store(done)
+	c.propagateCancel(parent, c)
+	return c, func() { c.cancel(true, Canceled, nil) }
+}
+
+// TestFinished 测试结束的时候WithTestCleanup的ctx用这个cause取消
+var TestFinished = errors.New("test finished")
+
+// WithTestCleanup 测试用的。 cleanup传t.Cleanup。 测试跑完了ctx自动以TestFinished取消
+// 返回的取消函数照样能用。 和cleanup谁先谁后都没关系
+func WithTestCleanup(parent Context, cleanup func(func())) (ctx Context, cancel CancelFunc) {
+	c := withCancel(parent)
+	cleanup(func() { c.cancel(true, Canceled, TestFinished) })
+	return c, func() { c.cancel(true, Canceled, nil) }
+}
+
+// WithCancelReporting 返回的取消函数会告诉你是不是自己取消的
+// 返回true 说明是这次调用把ctx取消的。 返回false 说明之前已经被parent或者别人取消了
+func WithCancelReporting(parent Context) (ctx Context, cancel func() bool) {
+	c := withCancel(parent)
+	return c, func() bool { return c.tryCancel(true, Canceled, nil) }
+}
+
+// WithReaderClose 读r读到EOF或者出错了。 就把ctx取消掉。 cause就是读出来的那个错误
+// 后台会开一个协程一直读r。 读到的数据直接丢掉
+// ctx取消之后协程会退出。 但是如果它正卡在Read里面。 要等Read返回才能退出
+// 所以要靠外面把r解除阻塞。 比如把conn关掉
+func WithReaderClose(parent Context, r io.Reader) (ctx Context, cancel CancelFunc) {
+	c := withCancel(parent)
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			select {
+			case <-c.Done():
+				return
+			default:
+			}
+			if _, err := r.Read(buf); err != nil {
+				c.cancel(true, Canceled, err)
+				return
+			}
+		}
+	}()
+	return c, func() { c.cancel(true, Canceled, nil) }
+}
+
+// WithErrorChan errc里来了第一个非nil的错误。 就把ctx取消掉。 Err()是Canceled。 cause就是这个错误
+// nil错误跳过。 errc关了也不取消。 只是不再看它了
+// ctx取消之后后台的协程就退出了
+func WithErrorChan(parent Context, errc <-chan error) (ctx Context, cancel CancelFunc) {
+	c := withCancel(parent)
+	go func() {
+		for {
+			select {
+			case <-c.Done():
+				return
+			case err, ok := <-errc:
+				if !ok {
+					return
+				}
+				if err != nil {
+					c.cancel(true, Canceled, err)
+					return
+				}
+			}
+		}
+	}()
+	return c, func() { c.cancel(true, Canceled, nil) }
+}
+
+// WithCauseTransform 这个ctx取消的时候。 传给孩子的cause先用transform转换一下。 自己还是留着原来的cause
+// 比如把内部的错误细节藏起来再往下传
+func WithCauseTransform(parent Context, transform func(error) error) (ctx Context, cancel CancelFunc) {
+	if parent == nil {
+		panic("cannot create context from nil parent")
+	}
+	c := &cancelCtx{transform: transform}
+	c.propagateCancel(parent, c)
+	return c, func() { c.cancel(true, Canceled, nil) }
+}
+
+// passCause 传给孩子的cause。 设置了transform的话先转换一下
+func (c *cancelCtx) passCause(cause error) error {
+	if c.transform != nil {
+		return c.transform(cause)
+	}
+	return cause
+}
+
+// parentCause 孩子从parent那里该拿到的cause
+func parentCause(parent Context) error {
+	cause := Cause(parent)
+	if p, ok := parent.Value(&cancelCtxKey).(*cancelCtx); ok {
+		return p.passCause(cause)
+	}
+	return cause
+}
+
+// ParentCanceled 用WithCancelDistinctParent创建的ctx。 如果是被parent连带取消的。 Err()会匹配上它
+var ParentCanceled = errors.New("context canceled by parent")
+
+// parentCanceledError 包着parent的err。 errors.Is 既能匹配ParentCanceled 也能匹配parent的err
+type parentCanceledError struct{ err error }
+
+func (e *parentCanceledError) Error() string        { return ParentCanceled.Error() + ": " + e.err.Error() }
+func (e *parentCanceledError) Is(target error) bool { return target == ParentCanceled }
+func (e *parentCanceledError) Unwrap() error        { return e.err }
+
+// WithCancelDistinctParent 和WithCancel一样。 只是被parent连带取消的时候。 Err()会包一层ParentCanceled
+// 这样就能分清是自己取消的还是上面取消的。 errors.Is(err, Canceled) 照样成立
+func WithCancelDistinctParent(parent Context) (ctx Context, cancel CancelFunc) {
+	if parent == nil {
+		panic("cannot create context from nil parent")
+	}
+	c := &parentAwareCtx{}
+	c.cancelCtx.propagateCancel(parent, c)
+	return c, func() { c.cancel(true, Canceled, nil) }
+}
+
+type parentAwareCtx struct {
+	cancelCtx
+}
+
+// parent那边来的取消 removeFromParent一定是false。 自己的取消函数传的是true
+func (c *parentAwareCtx) cancel(removeFromParent bool, err, cause error) bool {
+	if !removeFromParent {
+		err = &parentCanceledError{err}
+	}
+	canceled := c.cancelCtx.cancel(false, err, cause)
+	if removeFromParent {
+		removeChild(c.parent(), c)
+	}
+	return canceled
+}
+
+func (c *parentAwareCtx) String() string {
+	return contextName(c.parent()) + ".WithCancelDistinctParent"
+}
+
+func withCancel(parent Context) *cancelCtx {
+	if parent == nil {
+		panic("cannot create context from nil parent")
+	}
+	c := &cancelCtx{}
+	// 上面以及声明好了对象了。下面这个只能是将父context 与 子context链接
+	// 这个链接器没有带cancel功能
+	c.propagateCancel(parent, c)
+	return c
+}
+
+type stopCtx struct {
+	Context
+	stop func() bool
+}
+
+// goroutines counts the number of goroutines ever created; for testing.
+var goroutines atomic.Int32
+
+// &cancelCtxKey is the key that a cancelCtx returns itself for.
+var cancelCtxKey int
+
+// 猜测这个函数是判断 parent context 是不是 cancelctx
+func parentCancelCtx(parent Context) (*cancelCtx, bool) {
+	done := parent.Done()
+	if done == closedchan || done == nil {
+		return nil, false
+	}
+	p, ok := parent.Value(&cancelCtxKey).(*cancelCtx)
+	if !ok {
+		return nil, false
+	}
+	pdone, _ := p.done.Load().(chan struct{})
+	if pdone != done {
+		return nil, false
+	}
+	return p, true
+}
+
+// 父子分离
+func removeChild(parent Context, child canceler) {
+	if s, ok := parent.(stopCtx); ok {
+		s.stop()
+		return
+	}
+	p, ok := parentCancelCtx(parent)
+	if !ok {
+		return
+	}
+	// 摘孩子只拿孩子所在shard的锁。 不和parent的mu抢
+	p.deleteChild(child)
+}
+
+// 因为许多ctx是对cancelctx的继承。父子分离的时候。child 不一定为cancelctx。可能为timectx或者afterfuncctx
+// 但毫无意外。他们都需要分离。所以专门定义一个这样的接口。就不用判断了。
+type canceler interface {
+	// cancel 返回这一次调用是不是真的把ctx取消了。 已经取消过了就是false
+	cancel(removeFromParent bool, err, cause error) bool
+	Done() <-chan struct{}
+}
+
+// CancelNotifier 别人自己实现的Context可以实现这个接口。 挂在它下面的ctx就不用开协程盯着它的Done()了
+// RegisterCancel 登记一个回调。 ctx取消的时候调一次。 err就是Err()。 cause没有的话给nil就行
+// 登记的时候已经取消了的话。 要马上(或者很快)调f
+// 返回的unregister把登记撤掉。 孩子先取消的时候会调。 撤掉之后f就不能再被调了。 调多次也要没事
+type CancelNotifier interface {
+	RegisterCancel(f func(err, cause error)) (unregister func())
+}
+
+// TODO:不知道干什么的
+var closedchan = make(chan struct{})
+
+func init() {
+	close(closedchan)
+}
+
+type cancelCtx struct {
+	// context是为了继承context 的方法。好让cancelctx 可以被当作ctx传出去
+	Context
+
+	mu   sync.Mutex   // protects following fields except kids
+	done atomic.Value // of chan struct{}, created lazily, closed by first cancel call
+	// kids是为了链接children。parentctx cancel了。children也要跟着cancel
+	kids      atomic.Pointer[childSet]    // created lazily, closed by the first cancel call, has its own locks
+	few       [smallChildren]canceler     // the first children in registration order, used until kids is created
+	nfew      atomic.Int32                // number of children in few, written under mu
+	state     atomic.Pointer[cancelState] // set once by the first cancel call, read without mu
+	causes    []error                     // causes of later cancel calls, only kept when CollectCauses is set
+	transform func(error) error           // rewrites the cause handed down to children, set by WithCauseTransform
+	self      canceler                    // the outermost ctx embedding this one, as registered in the parent's children
+	path      []string                    // names the cancellation passed through, only kept when RecordCancelPath is set
+	syncFuncs []*syncFunc                 // callbacks run on the canceling goroutine, added by AfterFuncSync
+	cleanup   *cleanupList                // cleanups registered by OnCancel, created lazily
+	stack     string                      // where the ctx was created, only kept when RecordCreationStack is set
+	caller    string                      // who called the winning cancel, only kept when RecordCancelCaller is set
+	at        time.Time                   // when the winning cancel happened, only kept when RecordCancelCaller is set
+	leak      *runtime.Cleanup            // reports the ctx if it is collected before cancel, only set when OnLeak is set
+	tracked   bool                        // registered in the live table, only set when TrackLive is set
+	pooled    bool                        // made by NewRequestContext and safe to put back by ReleaseContext
+	lease     *requestLease               // the CancelFunc handed out by NewRequestContext, cut off by ReleaseContext
+	moved     atomic.Pointer[parentRef]   // the parent after Reparent, nil until then; read the parent through parent()
+	cache     atomic.Pointer[valueCache]  // recent lookups, only used when ValueCacheSize is set
+	fanout    *sync.WaitGroup             // children still being canceled outside mu, only set when ParallelCancel is set
+}
+
+// cancelState 第一次cancel的时候一起存进去。 之后就不变了
+type cancelState struct {
+	err   error
+	cause error
+}
+
+// OrderedCancel 打开之后。 cancel的时候按孩子挂上来的顺序一个一个取消
+// 默认关着。 map遍历是随机的。 但是快
+var OrderedCancel bool
+
+// smallChildren 前几个孩子直接存在cancelCtx里面。 不用去建childSet
+// 大部分ctx下面就挂0到2个孩子。 为了它们每次都建一个带shard的set太亏了
+const smallChildren = 2
+
+// addChild 把孩子挂上来。 调用前不能持有c.mu
+// c已经取消了的话返回false。 挂不上去。 调用的人自己去取消孩子
+// 还没建childSet的时候拿c.mu往few里放。 放满了才建set。 建了set以后就不再拿c.mu了
+func (c *cancelCtx) addChild(child canceler) bool {
+	s := c.kids.Load()
+	if s == nil {
+		c.mu.Lock()
+		if c.state.Load() != nil {
+			c.mu.Unlock()
+			return false
+		}
+		if s = c.kids.Load(); s == nil {
+			if n := c.nfew.Load(); n < smallChildren {
+				c.few[n] = child
+				c.nfew.Store(n + 1)
+				c.mu.Unlock()
+				return true
+			}
+			s = &childSet{}
+			c.kids.Store(s)
+		}
+		c.mu.Unlock()
+	}
+	return s.add(child)
+}
+
+// deleteChild 把孩子摘下来。 调用前不能持有c.mu
+// few里面没有东西的话就不拿c.mu。 活得久的parent前几个孩子早就走了。 后面的都只拿shard的锁
+func (c *cancelCtx) deleteChild(child canceler) {
+	if c.nfew.Load() > 0 {
+		c.mu.Lock()
+		n := c.nfew.Load()
+		for i := int32(0); i < n; i++ {
+			if c.few[i] == child {
+				// 往前挪。 few里面一直是挂上来的顺序
+				copy(c.few[i:n], c.few[i+1:n])
+				c.few[n-1] = nil
+				c.nfew.Store(n - 1)
+				c.mu.Unlock()
+				return
+			}
+		}
+		c.mu.Unlock()
+	}
+	if s := c.kids.Load(); s != nil {
+		s.remove(child)
+	}
+}
+
+// takeChildren 把孩子全拿出来。 调用前要持有c.mu
+// close为true的话以后就挂不上来了。 cancel用的
+// few里的一定比set里的先挂上来。 所以放在前面。 OrderedCancel的顺序不会乱
+func (c *cancelCtx) takeChildren(close bool) []canceler {
+	n := c.nfew.Load()
+	children := make([]canceler, n)
+	copy(children, c.few[:n])
+	c.few = [smallChildren]canceler{}
+	c.nfew.Store(0)
+	s := c.kids.Load()
+	if s == nil {
+		if close {
+			c.kids.Store(closedChildren)
+		}
+		return children
+	}
+	return append(children, s.drain(close)...)
+}
+
+// childList 抄一份现在挂着的孩子。 调试用的。 调用前不能持有c.mu
+func (c *cancelCtx) childList() []canceler {
+	c.mu.Lock()
+	children := append([]canceler(nil), c.few[:c.nfew.Load()]...)
+	c.mu.Unlock()
+	if s := c.kids.Load(); s != nil {
+		children = append(children, s.snapshot()...)
+	}
+	return children
+}
+
+// context还有存储数据的功能
+func (c *cancelCtx) Value(key any) any {
+	if key == &cancelCtxKey {
+		return c
+	}
+	if ValueCacheSize > 0 {
+		return c.cachedValue(key)
+	}
+	return value(c.parent(), key)
+}
+
+// OnDoneAlloc cancelCtx第一次在Done()里面创建done的时候调用。 参数是ctx的名字。 WithTimeout这种包了一层的报外层的名字
+// 用来找是谁在没必要的地方调了Done()。 nil就不调。 在锁外面调的
+var OnDoneAlloc func(name string)
+
+// 发送结束信号
+func (c *cancelCtx) Done() <-chan struct{} {
+	d := c.done.Load()
+	if d != nil {
+		return d.(chan struct{})
+	}
+	c.mu.Lock()
+
+	// TODO：这只是一个信号。为了节约空间。没有给他开辟空间
+	// 要结束的时候。才给他开辟空间
+	// 这里的chan不做池化复用。 能进池子的只能是没关过的chan。 可是chan一旦从Done()交出去
+	// 就不知道还有谁拿着它在select。 复用给别的ctx再关掉。 旧的等待方会被错误地唤醒
+	// 从来没交出去过的情况。 取消的时候本来就用的是共享的closedchan。 没有分配可以省
+	created := false
+	d = c.done.Load()
+	if d == nil {
+		d = make(chan struct{})
+		c.done.Store(d)
+		created = true
+	}
+	c.mu.Unlock()
+
+	// 只有真正创建的那一次才回调。 放在锁外面。 回调里面再碰这个ctx也不会死锁
+	if created {
+		if f := OnDoneAlloc; f != nil {
+			f(c.name())
+		}
+	}
+	return d.(chan struct{})
+}
+
+// DoneMaterialized 看看ctx背后的cancelCtx是不是已经把done存上了。 不会调Done() 所以不会触发创建
+// 没调过Done()就取消了的话。 存的是共用的closedchan。 也算存上了
+// 只是给内存统计用的
+func DoneMaterialized(ctx Context) bool {
+	c, ok := ctx.Value(&cancelCtxKey).(*cancelCtx)
+	if !ok {
+		return false
+	}
+	return c.done.Load() != nil
+}
+
+// 查看cancel context的错误
+// Err 不拿锁。 一直轮询ctx.Err()的循环不会和别人抢锁
+func (c *cancelCtx) Err() error {
+	if s := c.state.Load(); s != nil {
+		return s.err
+	}
+	return nil
+}
+
+// loadCause 和Err一样不拿锁
+func (c *cancelCtx) loadCause() error {
+	if s := c.state.Load(); s != nil {
+		return s.cause
+	}
+	return nil
+}
+
+// 融合取消。如果上层结束了。马上就执行下层的cancel
+// cancel context 融合进context。注意这里是context 不是 cancel context。 context包含了cancel context
+func (c *cancelCtx) propagateCancel(parent Context, child canceler) {
+	c.setup(parent, child)
+	c.attach(parent, child)
+}
+
+// parentRef 包一层。 好放进atomic.Pointer
+type parentRef struct {
+	Context
+}
+
+// parent 现在的parent。 Reparent过的话是换过去的那个
+func (c *cancelCtx) parent() Context {
+	if p := c.moved.Load(); p != nil {
+		return p.Context
+	}
+	return c.Context
+}
+
+// setParent 记下parent。 创建的时候ctx还没给出去。 直接写c.Context就行
+// Reparent过以后别的协程可能正在往上查值。 只能原子地换
+func (c *cancelCtx) setParent(p Context) {
+	if c.moved.Load() != nil {
+		c.moved.Store(&parentRef{p})
+		return
+	}
+	c.Context = p
+}
+
+func (c *cancelCtx) Deadline() (deadline time.Time, ok bool) {
+	return c.parent().Deadline()
+}
+
+// setup 记下parent和外层的ctx。 再做调试和埋点要的事。 只在创建的时候做一次
+func (c *cancelCtx) setup(parent Context, child canceler) {
+	c.Context = parent
+	c.self = child
+	if RecordCreationStack {
+		c.stack = callerStack()
+	}
+	if OnLeak != nil {
+		c.watchLeak()
+	}
+	if TrackLive {
+		c.trackLive()
+	}
+	c.metricsCreated()
+	if self, ok := child.(Context); ok {
+		if _, internal := child.(*afterFuncCtx); !internal {
+			hooked(self)
+		}
+	}
+}
+
+// attach 真正挂到parent上。 Reparent换parent的时候直接调它
+func (c *cancelCtx) attach(parent Context, child canceler) {
+	c.setParent(parent)
+	done := parent.Done()
+	if done == nil {
+		return // parent is never canceled
+	}
+
+	// 这里就像 mysql的驱动一样。如果接到了上层的取消信号。就没必要再链接了
+	select {
+	case <-done:
+		// parent context 已经取消了。
+		child.cancel(false, parent.Err(), parentCause(parent))
+		return
+	default:
+	}
+
+	// 如果 parentcontext 是cancel context。就将子context 链接进 parent context
+	if p, ok := parentCancelCtx(parent); ok {
+		// 挂不上去说明 parent context 已经取消了。上面出错了。下面赶紧取消
+		// err是在关掉孩子的set之前设好的。 这里一定能读到
+		if !p.addChild(child) {
+			// parent has already been canceled
+			child.cancel(false, p.Err(), p.passCause(p.loadCause()))
+		}
+		return
+	}
+
+	// 如果 parentcontext 是afterCtx
+	// cancelctx 升级为 afterctx
+	if a, ok := parent.(afterFuncer); ok {
+		// parent implements an AfterFunc method.
+		c.mu.Lock()
+		// err 和 cause 一定要在闭包里面取。 这样拿到的是parent真正取消那一刻的原因
+		// 要是在外面先取好。 拿到的就是挂上去那一刻的。 那时候parent还没取消。 都是nil
+		stop := a.AfterFunc(func() {
+			child.cancel(false, parent.Err(), parentCause(parent))
+		})
+		c.setParent(stopCtx{
+			Context: parent,
+			stop:    stop,
+		})
+		c.mu.Unlock()
+		return
+	}
+
+	// 别人自己实现的ctx。 自己会在取消的时候通知我们。 和afterFuncer一样不用开协程
+	// 登记的时候parent正在取消的话。 RegisterCancel会当场调f。 f要拿c.mu。 所以登记不能拿着锁
+	// parent要在登记之前存好。 f一跑起来别的地方就可能来读它
+	if n, ok := parent.(CancelNotifier); ok {
+		var unregister atomic.Pointer[func()]
+		c.mu.Lock()
+		c.setParent(stopCtx{
+			Context: parent,
+			stop: func() bool {
+				if u := unregister.Load(); u != nil {
+					(*u)()
+				}
+				return true
+			},
+		})
+		c.mu.Unlock()
+		u := n.RegisterCancel(func(err, cause error) {
+			if cause == nil {
+				cause = err
+			}
+			child.cancel(false, err, cause)
+		})
+		unregister.Store(&u)
+		// 登记完之前ctx就取消了的话。 摘的时候还拿不到unregister。 这里自己撤。 撤两次也没事
+		if c.Err() != nil {
+			u()
+		}
+		return
+	}
+
+	// 不是上述几种情况的话. 子context没办法链接进 parent context。
+	// 说明 parent context 是 todocontext
+	// 开个后台监控这两个context什么时候取消
+	// 这样的话。架构猜测：
+	// 		1
+	// 		1 child 在这
+	// 2 2 2 2 2
+	goroutines.Add(1)
+	go func() {
+		select {
+		case <-parent.Done():
+			child.cancel(false, parent.Err(), parentCause(parent))
+		case <-child.Done():
+		}
+	}()
+}
+
+func (c *cancelCtx) String() string {
+	return contextName(c.parent()) + ".WithCancel"
+}
+
+// 真正的取消 cancel context的功能
+func (c *cancelCtx) cancel(removeFromParent bool, err, cause error) bool {
+	return c.tryCancel(removeFromParent, err, cause)
+}
+
+// tryCancel 和cancel一样。 只是会告诉你这一次调用是不是真的把ctx取消了
+// 已经被取消过了(比如parent先取消了)就返回false
+func (c *cancelCtx) tryCancel(removeFromParent bool, err, cause error) bool {
+	if err == nil {
+		panic("context: internal error: missing cancel error")
+	}
+	if cause == nil {
+		cause = err
+	}
+
+	// 加锁。防止并发冲突 比如。父ctx关闭了。他会遍历子ctx。如果这个时候子ctx也关闭了。就冲突了。所以加锁
+	c.mu.Lock()
+	if c.state.Load() != nil {
+		// 已经取消过了。 打开了CollectCauses的话。 把后来的原因也记下来
+		if CollectCauses {
+			c.causes = append(c.causes, cause)
+		}
+		c.mu.Unlock()
+		return false // already canceled
+	}
+	// 在关done之前存好。 看到done关了的人一定能读到err
+	c.state.Store(&cancelState{err, cause})
+	if RecordCancelPath {
+		c.path = append(c.path, c.name())
+	}
+	if RecordCancelCaller {
+		c.caller = cancelCaller()
+		c.at = time.Now()
+	}
+	if c.leak != nil {
+		c.leak.Stop()
+		c.leak = nil
+	}
+	if c.tracked {
+		c.untrackLive()
+	}
+	// 这里 c.done 其实就是那个chan的空结构体的信号隧道
+	d, _ := c.done.Load().(chan struct{})
+	if d == nil {
+		c.done.Store(closedchan)
+	} else {
+		close(d)
+	}
+
+	// 上层context已经取消了。 下层context 也跟着取消
+	// 打开了OrderedCancel的话。 拿出来的时候已经按挂上来的顺序排好了
+	childCause := c.passCause(cause)
+	children := c.takeChildren(true)
+	var fanout *sync.WaitGroup
+	if ParallelCancel > 1 && !OrderedCancel && len(children) >= parallelCancelMin {
+		// 孩子太多。 放开锁之后再分给几个协程一起取消。 ReleaseContext要等这个做完
+		fanout = new(sync.WaitGroup)
+		c.fanout = fanout
+	} else {
+		for _, child := range children {
+			// NOTE: acquiring the child's lock while holding parent's lock.
+			c.passPath(child)
+			child.cancel(false, err, childCause)
+		}
+	}
+
+	fs := c.syncFuncs
+	c.syncFuncs = nil
+	c.mu.Unlock()
+
+	if fanout != nil {
+		c.cancelParallel(fanout, children, err, childCause)
+	}
+
+	c.metricsCanceled(err, cause)
+	c.hookCancel(err, cause)
+
+	// 同步的afterfunc在自己的锁外面跑。 按注册的顺序
+	for _, f := range fs {
+		f.run()
+	}
+
+	// 如果不是从parent context 取消的。
+	// 而就是这一个context 取消的。那么将这个context 与 parent context 分离
+	if removeFromParent {
+		removeChild(c.parent(), c)
+	}
+	return true
+}
+
+// ParallelCancel 大于1的时候。 孩子多(parallelCancelMin个以上)的ctx取消的时候
+// 先把孩子抄出来。 放开自己的锁。 再用最多这么多个协程一起去取消孩子。 全部取消完了cancel才返回
+// 一个ctx下面挂着几万个孩子的时候。 一个一个取消要几十毫秒。 还一直拿着锁
+// 打开了OrderedCancel的话就不并行。 不然顺序就乱了
+var ParallelCancel int
+
+const parallelCancelMin = 128
+
+// cancelParallel 已经放开c.mu了。 c.path不会再变。 passPath不加锁读它没问题
+func (c *cancelCtx) cancelParallel(wg *sync.WaitGroup, children []canceler, err, cause error) {
+	workers := min(ParallelCancel, len(children))
+	var next atomic.Int64
+	wg.Add(workers)
+	for range workers {
+		go func() {
+			defer wg.Done()
+			for {
+				i := next.Add(1) - 1
+				if i >= int64(len(children)) {
+					return
+				}
+				c.passPath(children[i])
+				children[i].cancel(false, err, cause)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// SameCancelRoot a和b背后是不是同一个cancelCtx。 是的话取消一个另一个也跟着取消
+// 两边都找不到cancelCtx的话返回false
+func SameCancelRoot(a, b Context) bool {
+	ca, ok := a.Value(&cancelCtxKey).(*cancelCtx)
+	if !ok {
+		return false
+	}
+	cb, ok := b.Value(&cancelCtxKey).(*cancelCtx)
+	return ok && ca == cb
+}
+
+// RecordCancelPath 打开之后。 取消一路传下去的时候。 每个节点都会记下从哪里一路取消过来的
+// 用CancelPath查。 调试用的。 默认关着。 同一个节点被好几个地方同时取消的时候路径不一定准
+var RecordCancelPath bool
+
+// CancelPath 取消从发起的节点一路传到ctx经过的节点名字。 最后一个就是ctx自己
+func CancelPath(ctx Context) []string {
+	c, ok := ctx.Value(&cancelCtxKey).(*cancelCtx)
+	if !ok {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.path...)
+}
+
+// name 用外层的名字。 timerCtx这些打印出来才对
+func (c *cancelCtx) name() string {
+	if self, ok := c.self.(Context); ok {
+		return contextName(self)
+	}
+	return contextName(c)
+}
+
+// passPath 取消孩子之前把自己的路径交给孩子。 拿着自己的锁去拿孩子的锁。 和cancel里的顺序一样
+func (c *cancelCtx) passPath(child canceler) {
+	if !RecordCancelPath {
+		return
+	}
+	cc, ok := child.(Context)
+	if !ok {
+		return
+	}
+	own, ok := cc.Value(&cancelCtxKey).(*cancelCtx)
+	if !ok {
+		return
+	}
+	own.mu.Lock()
+	if own.Err() == nil {
+		own.path = append([]string(nil), c.path...)
+	}
+	own.mu.Unlock()
+}
+
+// CancelIfLive 还没取消就用cause取消掉。 返回(true, nil)
+// 已经取消了就什么都不做。 返回(false, 已有的err)
+// 判断和取消是一起在锁里做的。 不会出现先看Err()再取消中间被别人抢了的情况
+func CancelIfLive(ctx Context, cause error) (canceled bool, existing error) {
+	c, ok := ctx.Value(&cancelCtxKey).(*cancelCtx)
+	if !ok {
+		return false, ctx.Err()
+	}
+	// 从最外层取消。 父子分离、停timer都在这一次调用里做完
+	self := c.self
+	if self == nil {
+		self = c
+	}
+	if !self.cancel(true, Canceled, cause) {
+		return false, c.Err()
+	}
+	return true, nil
+}
+
+// Reparent 把ctx的取消挂到newParent下面。 以后是newParent取消才会连带取消它。 原来的parent不管了
+// ctx下面的子孙原样保留。 但是ctx自己往上找值也会改成从newParent找
+// ctx或者newParent已经取消了。 或者原来的parent是靠后台协程盯着的(摘不下来)。 或者ctx是WithParents建的。 都返回false
+// 并发: 从旧parent摘下来到挂上newParent中间。 旧parent取消了不会再传过来
+// 这段时间ctx自己被取消了的话。 就不再挂了。 返回false
+// 换parent的时候别的协程可以接着用ctx查值或者截止日期。 看到的是旧parent还是新parent都有可能
+// newParent是ctx自己或者它的子孙的话返回false。 不然就成环了。 查值和取消都会在环里转
+func Reparent(ctx Context, newParent Context) bool {
+	if newParent == nil {
+		panic("cannot reparent onto nil parent")
+	}
+	c, ok := ctx.Value(&cancelCtxKey).(*cancelCtx)
+	if !ok || c.self == nil || newParent.Err() != nil {
+		return false
+	}
+	// 两个Reparent同时把对方挂到自己下面也会成环。 所以一次只换一个
+	reparentMu.Lock()
+	defer reparentMu.Unlock()
+	if descendantOf(newParent, c) {
+		return false
+	}
+	// WithParents建的ctx有好几个parent。 不知道该换哪一个
+	if _, ok := c.self.(*parentsCtx); ok {
+		return false
+	}
+	old := c.parent()
+	if c.Err() != nil {
+		return false
+	}
+	if _, ok := old.(stopCtx); !ok && old.Done() != nil {
+		if _, ok := parentCancelCtx(old); !ok {
+			return false
+		}
+	}
+
+	removeChild(old, c.self)
+	if c.Err() != nil {
+		return false
+	}
+	// 先换掉parent。 attach里面再记就都走原子的那条路了
+	c.moved.Store(&parentRef{newParent})
+	c.attach(newParent, c.self)
+	// 往上找值的链换了。 自己和子孙以前记下来的都不算了
+	reparentGen.Add(1)
+	return c.Err() == nil
+}
+
+var reparentMu sync.Mutex // serializes Reparent so two calls cannot build a cycle together
+
+// descendantOf n是不是c自己或者c下面的。 从n一路往上找
+func descendantOf(n Context, c *cancelCtx) bool {
+	for n != nil {
+		if x, ok := n.(canceler); ok && x == c.self {
+			return true
+		}
+		p := parentOf(n)
+		if p == nil {
+			// 别人自己实现的ctx。 parentOf看不穿。 从它背后的cancelCtx接着往上
+			cc, ok := n.Value(&cancelCtxKey).(*cancelCtx)
+			if !ok || cc.self == nil {
+				return false
+			}
+			p, _ = cc.self.(Context)
+			if p == n {
+				return false
+			}
+		}
+		n = p
+	}
+	return false
+}
+
+// CollectCauses 打开之后。 第一次取消之后再来的取消原因也会记下来。 用AllCauses查
+// 几个子系统差不多同时取消的时候。 方便看到底都是谁
+var CollectCauses bool
+
+// AllCauses 返回所有的取消原因。 第一个就是Cause(ctx)。 后面是后来的
+// 没取消返回nil
+func AllCauses(ctx Context) []error {
+	c, ok := ctx.Value(&cancelCtxKey).(*cancelCtx)
+	if !ok {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cause := c.loadCause()
+	if cause == nil {
+		return nil
+	}
+	return append([]error{cause}, c.causes...)
+}
+
+// CancelDescendants 把ctx下面的子孙全部取消。 自己不取消
+// 返回取消了几个直接的孩子。 取消完了之后还能继续挂新的孩子
+func CancelDescendants(ctx Context, cause error) int {
+	c, ok := ctx.Value(&cancelCtxKey).(*cancelCtx)
+	if !ok {
+		return 0
+	}
+	if cause == nil {
+		cause = Canceled
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// 自己的done err都不动。 只是把孩子清空
+	children := c.takeChildren(false)
+	for _, child := range children {
+		// NOTE: acquiring the child's lock while holding parent's lock.
+		child.cancel(false, Canceled, cause)
+	}
+	return len(children)
+}
@@ -0,0 +1,1015 @@
+package context
+
+import (
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCancelIfLive(t *testing.T) {
+	ctx, cancel := WithCancel(Background())
+	defer cancel()
+	x := errors.New("x")
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	won := 0
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if canceled, _ := CancelIfLive(ctx, x); canceled {
+				mu.Lock()
+				won++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if won != 1 {
+		t.Fatalf("%d callers canceled, want 1", won)
+	}
+	canceled, existing := CancelIfLive(ctx, x)
+	if canceled || existing != Canceled {
+		t.Fatalf("CancelIfLive on canceled ctx = %v, %v; want false, %v", canceled, existing, Canceled)
+	}
+	if got := Cause(ctx); got != x {
+		t.Fatalf("Cause = %v, want %v", got, x)
+	}
+}
+
+func TestCancelIfLiveRemovesChild(t *testing.T) {
+	CollectCauses = true
+	defer func() { CollectCauses = false }()
+
+	parent, cancelParent := WithCancel(Background())
+	defer cancelParent()
+	p := parent.(*cancelCtx)
+	x := errors.New("x")
+
+	for _, newChild := range []func() (Context, CancelFunc){
+		func() (Context, CancelFunc) { return WithCancel(parent) },
+		func() (Context, CancelFunc) { return WithTimeout(parent, time.Hour) },
+	} {
+		child, cancel := newChild()
+		if n := len(p.childList()); n != 1 {
+			t.Fatalf("parent has %d children, want 1", n)
+		}
+		if canceled, _ := CancelIfLive(child, x); !canceled {
+			t.Fatalf("CancelIfLive(%v) = false, want true", child)
+		}
+		if n := len(p.childList()); n != 0 {
+			t.Errorf("%v: parent still has %d children after CancelIfLive", child, n)
+		}
+		if got := AllCauses(child); len(got) != 1 || got[0] != x {
+			t.Errorf("%v: AllCauses = %v, want [%v]", child, got, x)
+		}
+		cancel()
+	}
+}
+
+func TestReparent(t *testing.T) {
+	a, cancelA := WithCancel(Background())
+	b, cancelB := WithCancel(WithValue(Background(), "k", "b"))
+	defer cancelB()
+	ctx, cancel := WithCancel(a)
+	defer cancel()
+
+	if !Reparent(ctx, b) {
+		t.Fatal("Reparent = false, want true")
+	}
+	if got := ctx.Value("k"); got != "b" {
+		t.Errorf("Value after Reparent = %v, want b", got)
+	}
+	cancelA()
+	if err := ctx.Err(); err != nil {
+		t.Fatalf("canceling the old parent canceled ctx: %v", err)
+	}
+	cancelB()
+	if err := ctx.Err(); err != Canceled {
+		t.Fatalf("Err after canceling the new parent = %v, want %v", err, Canceled)
+	}
+}
+
+func TestReparentCycle(t *testing.T) {
+	root, cancelRoot := WithCancel(Background())
+	defer cancelRoot()
+	mid, cancelMid := WithCancel(WithValue(root, "k", 1))
+	defer cancelMid()
+	leaf, cancelLeaf := WithTimeout(mid, time.Hour)
+	defer cancelLeaf()
+
+	// 挂到自己或者自己下面的都会成环
+	for _, tt := range []struct {
+		name string
+		to   Context
+	}{
+		{"itself", mid},
+		{"child", leaf},
+		{"value below child", WithValue(leaf, "x", 2)},
+		{"WithoutCancel below child", WithoutCancel(leaf)},
+	} {
+		if Reparent(mid, tt.to) {
+			t.Errorf("Reparent(mid, %s) = true, want false", tt.name)
+		}
+	}
+	if got := leaf.Value("k"); got != 1 {
+		t.Errorf("Value after refused Reparent = %v, want 1", got)
+	}
+	cancelMid()
+	if err := leaf.Err(); err != Canceled {
+		t.Errorf("leaf Err() = %v, want %v", err, Canceled)
+	}
+}
+
+func TestReparentStaleDescendants(t *testing.T) {
+	ValueCacheSize = 8
+	defer func() { ValueCacheSize = 0 }()
+	pa, cancelA := WithCancel(WithValue(Background(), "k", "A"))
+	defer cancelA()
+	pb, cancelB := WithCancel(WithValue(Background(), "k", "B"))
+	defer cancelB()
+	mid, cancelMid := WithCancel(pa)
+	defer cancelMid()
+	leaf, cancelLeaf := WithCancel(WithValue(mid, "other", 1))
+	defer cancelLeaf()
+
+	// 先查一次。 mid和leaf都记下了A
+	if got := leaf.Value("k"); got != "A" {
+		t.Fatalf("leaf Value before Reparent = %v, want A", got)
+	}
+	if !Reparent(mid, pb) {
+		t.Fatal("Reparent = false, want true")
+	}
+	if got := mid.Value("k"); got != "B" {
+		t.Errorf("mid Value after Reparent = %v, want B", got)
+	}
+	if got := leaf.Value("k"); got != "B" {
+		t.Errorf("leaf Value after Reparent = %v, want B", got)
+	}
+}
+
+func TestReparentConcurrentLookups(t *testing.T) {
+	a, cancelA := WithTimeout(WithValue(Background(), "k", "a"), time.Hour)
+	defer cancelA()
+	b, cancelB := WithTimeout(WithValue(Background(), "k", "b"), time.Hour)
+	defer cancelB()
+	ctx, cancel := WithCancel(a)
+	defer cancel()
+
+	stop := make(chan struct{})
+	var wg, started sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		started.Add(1)
+		go func() {
+			defer wg.Done()
+			started.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if v := ctx.Value("k"); v != "a" && v != "b" {
+					t.Errorf("Value = %v, want a or b", v)
+					return
+				}
+				if _, ok := ctx.Deadline(); !ok {
+					t.Error("Deadline lost during Reparent")
+					return
+				}
+			}
+		}()
+	}
+	started.Wait()
+	for i := range 1000 {
+		p := a
+		if i%2 == 0 {
+			p = b
+		}
+		if !Reparent(ctx, p) {
+			t.Fatal("Reparent = false, want true")
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestOnDoneAlloc(t *testing.T) {
+	var mu sync.Mutex
+	var names []string
+	OnDoneAlloc = func(name string) {
+		mu.Lock()
+		names = append(names, name)
+		mu.Unlock()
+	}
+	defer func() { OnDoneAlloc = nil }()
+
+	ctx, cancel := WithCancel(Background())
+	defer cancel()
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx.Done()
+		}()
+	}
+	wg.Wait()
+	ctx.Done()
+
+	tctx, tcancel := WithTimeout(Background(), time.Hour)
+	defer tcancel()
+	tctx.Done()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(names) != 2 {
+		t.Fatalf("OnDoneAlloc called %d times, want 2: %q", len(names), names)
+	}
+	if names[0] != "context.Background.WithCancel" {
+		t.Errorf("name = %q, want context.Background.WithCancel", names[0])
+	}
+	if !strings.Contains(names[1], "WithDeadline") {
+		t.Errorf("name = %q, want the WithDeadline ctx", names[1])
+	}
+}
+
+// afterFuncParent 不是cancelCtx。 Done是自己的chan。 所以孩子只能通过AfterFunc挂上来
+// 值照样往里面那个ctx找。 Cause能看到里面的cause
+type afterFuncParent struct {
+	Context
+	done chan struct{}
+}
+
+func newAfterFuncParent() (*afterFuncParent, CancelCauseFunc) {
+	ctx, cancel := WithCancelCause(Background())
+	p := &afterFuncParent{Context: ctx, done: make(chan struct{})}
+	AfterFunc(ctx, func() { close(p.done) })
+	return p, cancel
+}
+
+func (p *afterFuncParent) Done() <-chan struct{}          { return p.done }
+func (p *afterFuncParent) AfterFunc(f func()) func() bool { return AfterFunc(p.Context, f) }
+
+func TestAfterFuncParentCause(t *testing.T) {
+	parent, cancelParent := newAfterFuncParent()
+	child, cancel := WithCancel(parent)
+	defer cancel()
+	if _, ok := child.(*cancelCtx).parent().(stopCtx); !ok {
+		t.Fatalf("child not attached through AfterFunc: parent is %T", child.(*cancelCtx).parent())
+	}
+
+	x := errors.New("x")
+	cancelParent(x)
+	select {
+	case <-child.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("child not canceled after parent")
+	}
+	if err := child.Err(); err != Canceled {
+		t.Errorf("Err() = %v, want %v", err, Canceled)
+	}
+	// cause是在回调跑的时候取的。 挂上去的时候parent还没取消
+	if got := Cause(child); got != x {
+		t.Errorf("Cause = %v, want %v", got, x)
+	}
+}
+
+func TestWithCancelReporting(t *testing.T) {
+	ctx, cancel := WithCancelReporting(Background())
+	if !cancel() {
+		t.Fatal("first cancel = false, want true")
+	}
+	if cancel() {
+		t.Fatal("second cancel = true, want false")
+	}
+	if ctx.Err() != Canceled {
+		t.Fatalf("Err() = %v, want %v", ctx.Err(), Canceled)
+	}
+
+	// parent和孩子自己一起取消。 孩子的cancel只有在parent还没传下来的时候才返回true
+	for range 100 {
+		parent, cancelParent := WithCancel(Background())
+		child, cancelChild := WithCancelReporting(parent)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			cancelParent()
+		}()
+		<-child.Done()
+		<-done
+		if cancelChild() {
+			t.Fatal("cancel after the parent canceled = true, want false")
+		}
+	}
+}
+
+func TestWithReaderClose(t *testing.T) {
+	r, w := io.Pipe()
+	ctx, cancel := WithReaderClose(Background(), r)
+	defer cancel()
+	w.Close()
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("ctx not canceled after the write end was closed")
+	}
+	if got := Cause(ctx); got != io.EOF {
+		t.Fatalf("Cause = %v, want %v", got, io.EOF)
+	}
+
+	x := errors.New("x")
+	r, w = io.Pipe()
+	ctx, cancel = WithReaderClose(Background(), r)
+	defer cancel()
+	w.CloseWithError(x)
+	<-ctx.Done()
+	if got := Cause(ctx); got != x {
+		t.Fatalf("Cause = %v, want %v", got, x)
+	}
+}
+
+func TestOrderedCancel(t *testing.T) {
+	OrderedCancel = true
+	defer func() { OrderedCancel = false }()
+
+	root, cancel := WithCancel(Background())
+	var mu sync.Mutex
+	var got []string
+	var wg sync.WaitGroup
+	// 比smallChildren多。 放不下的那些也要按顺序
+	names := []string{"A", "B", "C", "D", "E", "F"}
+	for _, name := range names {
+		child, cancelChild := WithCancel(root)
+		defer cancelChild()
+		wg.Add(1)
+		AfterFuncSync(child, func() {
+			mu.Lock()
+			got = append(got, name)
+			mu.Unlock()
+			wg.Done()
+		})
+	}
+	cancel()
+	wg.Wait()
+	if strings.Join(got, "") != strings.Join(names, "") {
+		t.Fatalf("children canceled in order %v, want %v", got, names)
+	}
+}
+
+func TestDoneMaterialized(t *testing.T) {
+	ctx, cancel := WithCancel(Background())
+	defer cancel()
+	if DoneMaterialized(ctx) {
+		t.Fatal("fresh WithCancel reports Done materialized")
+	}
+	ctx.Done()
+	if !DoneMaterialized(ctx) {
+		t.Fatal("Done not materialized after calling Done()")
+	}
+	if DoneMaterialized(Background()) {
+		t.Fatal("Background reports Done materialized")
+	}
+}
+
+func TestCancelDescendants(t *testing.T) {
+	root, cancel := WithCancel(Background())
+	defer cancel()
+	a, _ := WithCancel(root)
+	a1, _ := WithCancel(a)
+	b, _ := WithTimeout(root, time.Hour)
+	b1, _ := WithCancel(WithValue(b, "k", 1))
+
+	x := errors.New("flush")
+	if n := CancelDescendants(root, x); n != 2 {
+		t.Fatalf("CancelDescendants = %d, want 2", n)
+	}
+	for _, c := range []Context{a, a1, b, b1} {
+		if Cause(c) != x {
+			t.Errorf("%v: Cause = %v, want %v", c, Cause(c), x)
+		}
+	}
+	if err := root.Err(); err != nil {
+		t.Fatalf("root canceled: %v", err)
+	}
+
+	c, cancelC := WithCancel(root)
+	defer cancelC()
+	if n := len(root.(*cancelCtx).childList()); n != 1 {
+		t.Fatalf("root has %d children after adding one, want 1", n)
+	}
+	cancel()
+	if c.Err() != Canceled {
+		t.Fatalf("new child Err() = %v, want %v", c.Err(), Canceled)
+	}
+}
+
+func TestCollectCauses(t *testing.T) {
+	CollectCauses = true
+	defer func() { CollectCauses = false }()
+
+	ctx, cancel := WithCancelCause(Background())
+	e1, e2 := errors.New("e1"), errors.New("e2")
+	var wg sync.WaitGroup
+	for _, e := range []error{e1, e2} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cancel(e)
+		}()
+	}
+	wg.Wait()
+
+	all := AllCauses(ctx)
+	if len(all) != 2 || !slices.Contains(all, e1) || !slices.Contains(all, e2) {
+		t.Fatalf("AllCauses = %v, want both %v and %v", all, e1, e2)
+	}
+	if Cause(ctx) != all[0] {
+		t.Fatalf("Cause = %v, want the first of AllCauses %v", Cause(ctx), all[0])
+	}
+}
+
+func TestWithErrorChan(t *testing.T) {
+	errc := make(chan error, 2)
+	ctx, cancel := WithErrorChan(Background(), errc)
+	defer cancel()
+	x := errors.New("x")
+	errc <- nil
+	errc <- x
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("ctx not canceled after an error arrived")
+	}
+	if ctx.Err() != Canceled || Cause(ctx) != x {
+		t.Fatalf("Err() = %v, Cause = %v; want %v, %v", ctx.Err(), Cause(ctx), Canceled, x)
+	}
+
+	// 关掉chan不算出错
+	errc = make(chan error)
+	ctx, cancel = WithErrorChan(Background(), errc)
+	defer cancel()
+	close(errc)
+	time.Sleep(10 * time.Millisecond)
+	if err := ctx.Err(); err != nil {
+		t.Fatalf("closing the channel canceled the ctx: %v", err)
+	}
+}
+
+func TestSameCancelRoot(t *testing.T) {
+	parent, cancel := WithCancel(Background())
+	defer cancel()
+	child := WithValue(parent, "k", 1)
+	if !SameCancelRoot(parent, child) {
+		t.Error("parent and WithValue child do not share a cancel root")
+	}
+	other, cancelOther := WithCancel(Background())
+	defer cancelOther()
+	if SameCancelRoot(parent, other) {
+		t.Error("two WithCancel contexts share a cancel root")
+	}
+	if SameCancelRoot(Background(), Background()) {
+		t.Error("Background shares a cancel root with itself")
+	}
+}
+
+func TestWithCancelDistinctParent(t *testing.T) {
+	ctx, cancel := WithCancelDistinctParent(Background())
+	cancel()
+	if err := ctx.Err(); err != Canceled || errors.Is(err, ParentCanceled) {
+		t.Fatalf("direct cancel: Err() = %v, want plain %v", err, Canceled)
+	}
+
+	parent, cancelParent := WithCancel(Background())
+	ctx, cancel = WithCancelDistinctParent(parent)
+	defer cancel()
+	cancelParent()
+	err := ctx.Err()
+	if !errors.Is(err, ParentCanceled) || !errors.Is(err, Canceled) {
+		t.Fatalf("parent cancel: Err() = %v, want both %v and %v", err, ParentCanceled, Canceled)
+	}
+}
+
+func TestWithCauseTransform(t *testing.T) {
+	internal := errors.New("db password wrong")
+	public := errors.New("service unavailable")
+	parent, cancelParent := WithCancelCause(Background())
+	ctx, cancel := WithCauseTransform(parent, func(err error) error {
+		if err == internal {
+			return public
+		}
+		return err
+	})
+	defer cancel()
+	child, cancelChild := WithCancel(ctx)
+	defer cancelChild()
+
+	cancelParent(internal)
+	if got := Cause(ctx); got != internal {
+		t.Errorf("Cause(ctx) = %v, want %v", got, internal)
+	}
+	if got := Cause(child); got != public {
+		t.Errorf("Cause(child) = %v, want %v", got, public)
+	}
+	// 取消之后才建的孩子也拿到转换过的
+	late, cancelLate := WithCancel(ctx)
+	defer cancelLate()
+	if got := Cause(late); got != public {
+		t.Errorf("Cause(late child) = %v, want %v", got, public)
+	}
+}
+
+func TestWithCancelCauses(t *testing.T) {
+	a := errors.New("disk full")
+	b := errors.New("quota exceeded")
+	ctx, cancel := WithCancelCauses(Background())
+	cancel(a, b)
+	if err := ctx.Err(); err != Canceled {
+		t.Errorf("Err() = %v, want %v", err, Canceled)
+	}
+	cause := Cause(ctx)
+	if !errors.Is(cause, a) || !errors.Is(cause, b) {
+		t.Errorf("Cause() = %v, want it to match both %v and %v", cause, a, b)
+	}
+
+	// 一个原因都不给就是普通的取消
+	ctx, cancel = WithCancelCauses(Background())
+	cancel()
+	if got := Cause(ctx); got != Canceled {
+		t.Errorf("Cause() with no causes = %v, want %v", got, Canceled)
+	}
+}
+
+func TestDoneNotReused(t *testing.T) {
+	held, cancelHeld := WithCancel(Background())
+	defer cancelHeld()
+	done := held.Done()
+	// 别的ctx不管是取消掉的还是直接丢掉的。 都不能拿到held还在用的chan
+	for i := 0; i < 100; i++ {
+		ctx, cancel := WithCancel(Background())
+		if ctx.Done() == done {
+			t.Fatalf("ctx %d got the Done channel still held by another ctx", i)
+		}
+		if i%2 == 0 {
+			cancel()
+		}
+	}
+	select {
+	case <-done:
+		t.Fatal("held Done channel closed without its ctx being canceled")
+	default:
+	}
+
+	// 没调过Done()就取消了的。 用的是共享的closedchan。 不用分配
+	ctx, cancel := WithCancel(Background())
+	cancel()
+	if ctx.Done() != closedchan {
+		t.Error("Done() after cancel-before-Done is not the shared closed channel")
+	}
+}
+
+func TestWithCancelChan(t *testing.T) {
+	// 关两次会panic。 所以没panic就说明只关了一次
+	done := make(chan struct{})
+	ctx, cancel := WithCancelChan(Background(), done)
+	if ctx.Done() != done {
+		t.Fatal("Done() is not the supplied channel")
+	}
+	cancel()
+	cancel()
+	select {
+	case <-done:
+	default:
+		t.Fatal("cancel did not close the supplied channel")
+	}
+	if err := ctx.Err(); err != Canceled {
+		t.Errorf("Err() = %v, want %v", err, Canceled)
+	}
+
+	done = make(chan struct{})
+	parent, cancelParent := WithCancel(Background())
+	ctx, cancel = WithCancelChan(parent, done)
+	cancelParent()
+	cancel()
+	select {
+	case <-done:
+	default:
+		t.Fatal("parent cancel did not close the supplied channel")
+	}
+	if err := ctx.Err(); err != Canceled {
+		t.Errorf("Err() after parent cancel = %v, want %v", err, Canceled)
+	}
+}
+
+func TestWithTestCleanup(t *testing.T) {
+	var registered []func()
+	record := func(f func()) { registered = append(registered, f) }
+
+	ctx, cancel := WithTestCleanup(Background(), record)
+	if len(registered) != 1 {
+		t.Fatalf("registered %d cleanups, want 1", len(registered))
+	}
+	registered[0]()
+	if err := ctx.Err(); err != Canceled {
+		t.Errorf("Err() = %v, want %v", err, Canceled)
+	}
+	if got := Cause(ctx); got != TestFinished {
+		t.Errorf("Cause() = %v, want %v", got, TestFinished)
+	}
+	// 之后再调取消函数不改cause
+	cancel()
+	if got := Cause(ctx); got != TestFinished {
+		t.Errorf("Cause() after cancel = %v, want %v", got, TestFinished)
+	}
+
+	// 先调取消函数。 cleanup再跑也不改
+	registered = nil
+	ctx, cancel = WithTestCleanup(Background(), record)
+	cancel()
+	registered[0]()
+	if got := Cause(ctx); got != Canceled {
+		t.Errorf("Cause() with cancel first = %v, want %v", got, Canceled)
+	}
+
+	// 真的交给t.Cleanup
+	var inner Context
+	t.Run("sub", func(t *testing.T) {
+		inner, _ = WithTestCleanup(Background(), t.Cleanup)
+	})
+	if got := Cause(inner); got != TestFinished {
+		t.Errorf("Cause() after subtest = %v, want %v", got, TestFinished)
+	}
+}
+
+func TestCancelPath(t *testing.T) {
+	RecordCancelPath = true
+	defer func() { RecordCancelPath = false }()
+	top, cancelTop := WithCancel(Background())
+	mid, cancelMid := WithCancel(WithValue(top, "k", 1))
+	defer cancelMid()
+	leaf, cancelLeaf := WithTimeout(mid, time.Hour)
+	defer cancelLeaf()
+
+	cancelTop()
+	path := CancelPath(leaf)
+	if len(path) != 3 {
+		t.Fatalf("CancelPath(leaf) = %q, want 3 nodes", path)
+	}
+	want := []string{contextName(top), contextName(mid)}
+	for i := range want {
+		if path[i] != want[i] {
+			t.Errorf("CancelPath(leaf)[%d] = %q, want %q", i, path[i], want[i])
+		}
+	}
+	// 名字里带着剩下多久。 只比前面
+	if prefix := contextName(mid) + ".WithDeadline("; !strings.HasPrefix(path[2], prefix) {
+		t.Errorf("CancelPath(leaf)[2] = %q, want the leaf %s...", path[2], prefix)
+	}
+}
+
+func TestParallelCancel(t *testing.T) {
+	ParallelCancel = 4
+	defer func() { ParallelCancel = 0 }()
+	x := errors.New("x")
+	root, cancelRoot := WithCancelCause(Background())
+	var leaves []Context
+	for i := range 4 * parallelCancelMin {
+		var ctx Context
+		var cancel CancelFunc
+		if i%2 == 0 {
+			ctx, cancel = WithCancel(root)
+		} else {
+			ctx, cancel = WithTimeout(root, time.Hour)
+		}
+		defer cancel()
+		grand, cancelGrand := WithCancel(WithValue(ctx, "i", i))
+		defer cancelGrand()
+		leaves = append(leaves, ctx, grand)
+	}
+
+	cancelRoot(x)
+	// cancel返回的时候。 并行的那几个协程已经全部做完了
+	for _, ctx := range leaves {
+		if err := ctx.Err(); err != Canceled {
+			t.Fatalf("%v: Err() = %v, want %v", ctx, err, Canceled)
+		}
+		if got := Cause(ctx); got != x {
+			t.Fatalf("%v: Cause() = %v, want %v", ctx, got, x)
+		}
+	}
+	if n := len(root.(*cancelCtx).childList()); n != 0 {
+		t.Fatalf("root still has %d children", n)
+	}
+}
+
+func TestChildSetShards(t *testing.T) {
+	root, cancelRoot := WithCancel(Background())
+	defer cancelRoot()
+	c := root.(*cancelCtx)
+	const n = 200
+	children := make([]Context, n)
+	cancels := make([]CancelFunc, n)
+	for i := range n {
+		children[i], cancels[i] = WithCancel(root)
+	}
+	s := c.kids.Load()
+	if s == nil {
+		t.Fatal("no childSet after more than smallChildren children")
+	}
+	if got := int(c.nfew.Load()) + s.len(); got != n {
+		t.Fatalf("registered %d children, want %d", got, n)
+	}
+	// 200个孩子应该分到了每一个shard里
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		empty := len(sh.m) == 0
+		sh.mu.Unlock()
+		if empty {
+			t.Errorf("shard %d is empty", i)
+		}
+	}
+
+	// 隔一个取消一个。 要从各自的shard里摘掉
+	for i := 0; i < n; i += 2 {
+		cancels[i]()
+	}
+	if got := int(c.nfew.Load()) + s.len(); got != n/2 {
+		t.Fatalf("after removing half: %d children, want %d", got, n/2)
+	}
+	for _, child := range c.childList() {
+		for i := 0; i < n; i += 2 {
+			if child == children[i].(canceler) {
+				t.Fatalf("canceled child %d still registered", i)
+			}
+		}
+	}
+
+	cancelRoot()
+	for i, child := range children {
+		if child.Err() == nil {
+			t.Fatalf("child %d live after the root was canceled", i)
+		}
+	}
+	if got := s.len(); got != 0 {
+		t.Fatalf("childSet has %d children after cancel, want 0", got)
+	}
+	// 取消之后再挂的直接取消
+	late, cancelLate := WithCancel(root)
+	defer cancelLate()
+	if late.Err() == nil {
+		t.Fatal("child of a canceled root is live")
+	}
+}
+
+func TestOrderedCancelShards(t *testing.T) {
+	OrderedCancel = true
+	defer func() { OrderedCancel = false }()
+
+	root, cancel := WithCancel(Background())
+	const n = 100
+	var mu sync.Mutex
+	var got []int
+	var cancels []CancelFunc
+	for i := range n {
+		child, cancelChild := WithCancel(root)
+		cancels = append(cancels, cancelChild)
+		AfterFuncSync(child, func() {
+			mu.Lock()
+			got = append(got, i)
+			mu.Unlock()
+		})
+	}
+	// 中间摘掉几个。 剩下的顺序不能乱
+	for _, i := range []int{0, 1, 17, 50, 99} {
+		cancels[i]()
+	}
+	mu.Lock()
+	got = nil
+	mu.Unlock()
+	cancel()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != n-5 {
+		t.Fatalf("canceled %d children, want %d", len(got), n-5)
+	}
+	if !slices.IsSorted(got) {
+		t.Fatalf("children canceled out of order: %v", got)
+	}
+}
+
+func TestInlineChildren(t *testing.T) {
+	OrderedCancel = true
+	defer func() { OrderedCancel = false }()
+	root, cancelRoot := WithCancel(Background())
+	c := root.(*cancelCtx)
+
+	// 前smallChildren个放在few里。 不建childSet
+	var children []Context
+	var cancels []CancelFunc
+	add := func() {
+		child, cancel := WithCancel(root)
+		children, cancels = append(children, child), append(cancels, cancel)
+	}
+	for range smallChildren {
+		add()
+	}
+	if c.kids.Load() != nil {
+		t.Fatal("childSet created before the inline slots were full")
+	}
+	if got := c.nfew.Load(); got != smallChildren {
+		t.Fatalf("nfew = %d, want %d", got, smallChildren)
+	}
+
+	// 摘掉第一个。 后面的往前挪。 顺序不变
+	cancels[0]()
+	if got := c.nfew.Load(); got != smallChildren-1 {
+		t.Fatalf("after removing an inline child: nfew = %d, want %d", got, smallChildren-1)
+	}
+	if c.few[0] != children[1].(canceler) || c.few[smallChildren-1] != nil {
+		t.Fatalf("few = %v, want the second child moved to the front", c.few)
+	}
+
+	// 空出来的位置先用。 满了才建set
+	add()
+	if c.kids.Load() != nil {
+		t.Fatal("childSet created while an inline slot was free")
+	}
+	add()
+	s := c.kids.Load()
+	if s == nil || s.len() != 1 {
+		t.Fatal("the child after the inline slots did not go to the childSet")
+	}
+
+	// 取消的时候few里的在前面。 set里的在后面
+	var got []Context
+	for _, child := range children[1:] {
+		AfterFuncSync(child, func() { got = append(got, child) })
+	}
+	cancelRoot()
+	if !slices.Equal(got, children[1:]) {
+		t.Fatalf("children canceled in order %v, want %v", got, children[1:])
+	}
+	if c.nfew.Load() != 0 || s.len() != 0 {
+		t.Fatal("children still registered after cancel")
+	}
+}
+
+func TestErrSetWhenDoneClosed(t *testing.T) {
+	for i := range 200 {
+		parent, cancelParent := WithCancel(Background())
+		var ctx Context
+		var cancel CancelFunc
+		switch i % 3 {
+		case 0:
+			ctx, cancel = WithCancel(parent)
+		case 1:
+			ctx, cancel = WithTimeout(parent, time.Duration(i%5)*time.Microsecond)
+		default:
+			ctx, cancel = WithCancel(WithValue(parent, "k", i))
+		}
+		var wg sync.WaitGroup
+		for range 4 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-ctx.Done()
+				// 看到done关了。 err和cause一定已经有了
+				if ctx.Err() == nil || Cause(ctx) == nil {
+					t.Error("Done closed but Err or Cause is nil")
+				}
+			}()
+		}
+		// 一半是自己和parent抢着取消。 timer的那些还会和到期抢
+		if i%2 == 0 {
+			go cancelParent()
+		}
+		go cancel()
+		wg.Wait()
+		cancelParent()
+	}
+}
+
+// notifierCtx 别人自己实现的ctx。 取消的时候按登记的顺序一个个通知
+type notifierCtx struct {
+	Context // Background, only for Deadline and Value
+	mu      sync.Mutex
+	done    chan struct{}
+	err     error
+	cause   error
+	fs      []*func(err, cause error)
+}
+
+func newNotifierCtx() *notifierCtx {
+	return &notifierCtx{Context: Background(), done: make(chan struct{})}
+}
+
+func (n *notifierCtx) Done() <-chan struct{} { return n.done }
+
+func (n *notifierCtx) Err() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.err
+}
+
+func (n *notifierCtx) RegisterCancel(f func(err, cause error)) func() {
+	n.mu.Lock()
+	if n.err != nil {
+		err, cause := n.err, n.cause
+		n.mu.Unlock()
+		f(err, cause)
+		return func() {}
+	}
+	p := &f
+	n.fs = append(n.fs, p)
+	n.mu.Unlock()
+	return func() {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		n.fs = slices.DeleteFunc(n.fs, func(o *func(err, cause error)) bool { return o == p })
+	}
+}
+
+func (n *notifierCtx) cancel(cause error) {
+	n.mu.Lock()
+	n.err, n.cause = Canceled, cause
+	fs := n.fs
+	n.fs = nil
+	n.mu.Unlock()
+	close(n.done)
+	for _, f := range fs {
+		(*f)(Canceled, cause)
+	}
+}
+
+func (n *notifierCtx) registered() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.fs)
+}
+
+func TestCancelNotifier(t *testing.T) {
+	before := goroutines.Load()
+	n := newNotifierCtx()
+	x := errors.New("x")
+
+	var order []int
+	var children []Context
+	for i := range 3 {
+		child, cancel := WithCancel(n)
+		defer cancel()
+		AfterFuncSync(child, func() { order = append(order, i) })
+		children = append(children, child)
+	}
+	// 先取消的孩子要把登记撤掉。 parent取消的时候不再通知它
+	extra, cancelExtra := WithCancel(n)
+	cancelExtra()
+	if got := n.registered(); got != 3 {
+		t.Fatalf("registered = %d after a child canceled itself, want 3", got)
+	}
+	if got := goroutines.Load(); got != before {
+		t.Fatalf("started %d goroutines, want none", got-before)
+	}
+
+	n.cancel(x)
+	// 回调里就取消完了。 顺序就是通知的顺序
+	if !slices.Equal(order, []int{0, 1, 2}) {
+		t.Fatalf("children canceled in order %v, want [0 1 2]", order)
+	}
+	for i, child := range children {
+		if err := child.Err(); err != Canceled {
+			t.Errorf("child %d: Err() = %v, want %v", i, err, Canceled)
+		}
+		if got := Cause(child); got != x {
+			t.Errorf("child %d: Cause() = %v, want %v", i, got, x)
+		}
+	}
+	if got := Cause(extra); got != Canceled {
+		t.Errorf("self-canceled child: Cause() = %v, want %v", got, Canceled)
+	}
+
+	// 已经取消了再挂上来。 马上就取消。 done已经关了。 和标准库一样直接用Err()。 看不到cause
+	late, cancelLate := WithCancel(n)
+	defer cancelLate()
+	if err := late.Err(); err != Canceled {
+		t.Errorf("child of a canceled notifier: Err() = %v, want %v", err, Canceled)
+	}
+
+	// 正在取消。 err有了done还没关。 这时候挂上来走RegisterCancel。 当场就通知
+	m := newNotifierCtx()
+	m.mu.Lock()
+	m.err, m.cause = Canceled, x
+	m.mu.Unlock()
+	mid, cancelMid := WithCancel(m)
+	defer cancelMid()
+	if got := Cause(mid); got != x {
+		t.Errorf("child registered during cancel: Cause() = %v, want %v", got, x)
+	}
+}
@@ -1,3 +1,7 @@
+//go:build ignore
+
+// 这里是读runtime/chan.go时候的笔记。 不参与构建
+
 package main
 
 import "unsafe"
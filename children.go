@@ -0,0 +1,113 @@
+package context
+
+import (
+	"hash/maphash"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// childShardCount 孩子分成几份存。 每份一把锁
+// 一个活得很久的ctx(比如整个服务的)下面同时挂着十几万个请求的ctx。 挂上摘下要是都抢同一把锁。 核多了也没用
+const childShardCount = 8
+
+// childSet 一个cancelCtx下面挂着的孩子。 按孩子的hash分到几个shard里。 挂上摘下只拿对应shard的锁。 不拿cancelCtx的mu
+// closed之后就不能再挂了。 add返回false。 挂的人自己去取消孩子
+type childSet struct {
+	closed atomic.Bool
+	seq    atomic.Uint64 // registration order, for OrderedCancel
+	shards [childShardCount]childShard
+}
+
+type childShard struct {
+	mu sync.Mutex
+	m  map[canceler]uint64 // child -> seq
+}
+
+var childSeed = maphash.MakeSeed()
+
+// closedChildren 还没挂过孩子就取消了的cancelCtx都指向它。 之后来挂的一律失败
+var closedChildren = func() *childSet {
+	s := &childSet{}
+	s.closed.Store(true)
+	return s
+}()
+
+func (s *childSet) shard(child canceler) *childShard {
+	return &s.shards[maphash.Comparable(childSeed, child)%childShardCount]
+}
+
+// add 挂上去。 已经closed了返回false
+// closed是在shard的锁里看的。 drain是先设closed再一个个shard去拿。 所以不会有孩子挂上去了却没人取消
+func (s *childSet) add(child canceler) bool {
+	sh := s.shard(child)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if s.closed.Load() {
+		return false
+	}
+	if sh.m == nil {
+		sh.m = make(map[canceler]uint64)
+	}
+	sh.m[child] = s.seq.Add(1)
+	return true
+}
+
+func (s *childSet) remove(child canceler) {
+	sh := s.shard(child)
+	sh.mu.Lock()
+	delete(sh.m, child)
+	sh.mu.Unlock()
+}
+
+// drain 把孩子全拿出来。 set里就空了。 close为true的话以后就不能再挂了
+// 打开了OrderedCancel的话按挂上来的顺序排好
+func (s *childSet) drain(close bool) []canceler {
+	if close {
+		s.closed.Store(true)
+	}
+	return s.collect(true)
+}
+
+// snapshot 抄一份。 不动set
+func (s *childSet) snapshot() []canceler {
+	return s.collect(false)
+}
+
+func (s *childSet) collect(take bool) []canceler {
+	type entry struct {
+		child canceler
+		seq   uint64
+	}
+	var all []entry
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		for child, seq := range sh.m {
+			all = append(all, entry{child, seq})
+		}
+		if take {
+			sh.m = nil
+		}
+		sh.mu.Unlock()
+	}
+	if OrderedCancel {
+		sort.Slice(all, func(i, j int) bool { return all[i].seq < all[j].seq })
+	}
+	children := make([]canceler, len(all))
+	for i, e := range all {
+		children[i] = e.child
+	}
+	return children
+}
+
+func (s *childSet) len() int {
+	n := 0
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		n += len(sh.m)
+		sh.mu.Unlock()
+	}
+	return n
+}
@@ -0,0 +1,219 @@
+// Package context 是照着标准库context抄出来再往上加东西的一份实现。
+// 用法和标准库一样: import "github.com/qingyun-007/context" 之后当context用就行。
+// cancel相关的在cancel.go。 定时的在timer.go。 带值的在value.go。
+package context
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// ctx core 总共分为两大类
+// 带cancel的。带cancel的为链式
+// 不带cancel的。 不带cancel的为单点
+
+// 带cancel的。首先声明。需要绑定一个头。cancelctx 作为第一个儿子
+// 需要和parentctx绑定。 绑定完了之后。将心脏也就是取消函数交出。
+// 和parentctx绑定。这个时候有三种情况
+// case1 parentctx是一个cancelctx。这样的话。直接将cancelctx 存入parentctx就可以了
+// case2 parentctx是一个afterfuncctx。这种情况。cancelctx也要升级为afterfuncctx
+// case3 parentctx是一个普通的ctx。这种情况就是强绑定了。 搞一个select绑定
+
+// 这是提前定义好了一个取消错误。用于处理err的
+// 和DeadlineExceeded一样做成了结构体。 这样Error()的时候可以去问CanceledMessage
+var Canceled error = canceledError{}
+
+type canceledError struct{}
+
+func (canceledError) Error() string {
+	if f := CanceledMessage; f != nil {
+		return f()
+	}
+	return "context canceled"
+}
+
+// CanceledMessage DeadlineMessage 可以换掉Canceled和DeadlineExceeded的错误信息。 比如做本地化
+// nil就用默认的。 只改文字。 errors.Is(err, Canceled) 这些判断不受影响
+var CanceledMessage, DeadlineMessage func() string
+
+// Context
+// 1.Context
+// Context context四件套。实现了这个方法的就是context
+// 根Ctx。 cancelCtx withoutCancelCtx timerCtx afterFuncCtx valueCtx emptyCtx 都是对根ctx的继承
+// 其中 除了withoutcancel 以及 valuectx 其他的都是继承自cancelCtx cancelCtx继承根ctx
+// 像withdeadline之类的都是对cancel的功能封装
+
+// Context主要是为了管理协程的声明周期。所以有Done() Err() 就可以了 Deadline 以及 Value是附加功能
+// 因为ctx的核心功能就是这两个。只要用好多态特性。ctx不需要干嘛就err 以及 done。其他操作都再cancel 或其他func那
+// 这就可以很好的利用多态的特性。只要封装好不同的函数就可以了。不需要不同形态的ctx返回不同的类型
+type Context interface {
+	Deadline() (deadline time.Time, ok bool)
+	Done() <-chan struct{}
+	Err() error
+	Value(key any) any
+}
+
+// emptyCtx 空context
+// 空ctx。contexts可以理解成一棵树。最顶上的context肯定是一个空白的context
+type emptyCtx struct{}
+
+func (emptyCtx) Deadline() (deadline time.Time, ok bool) {
+	return
+}
+
+func (emptyCtx) Done() <-chan struct{} {
+	return nil
+}
+
+func (emptyCtx) Err() error {
+	return nil
+}
+
+func (emptyCtx) Value(key any) any {
+	return nil
+}
+
+type backgroundCtx struct{ emptyCtx }
+type todoCtx struct{ emptyCtx }
+
+func (backgroundCtx) String() string {
+	return "context.Background"
+}
+func (todoCtx) String() string {
+	return "context.TODO"
+}
+
+func Background() Context {
+	return backgroundCtx{}
+}
+func TODO() Context {
+	return todoCtx{}
+}
+
+type stringer interface {
+	String() string
+}
+
+func contextName(c Context) string {
+	// 起了名字的ctx。直接用名字。子ctx打印出来就是 name.WithCancel 这种
+	if n, ok := c.(*nameCtx); ok {
+		return n.name
+	}
+	if b, ok := c.(*builtCtx); ok && b.name != "" {
+		return b.name
+	}
+	// 这里把多态体现的淋漓尽致。 从context 转换成 stringer
+	// 这样一个对象，就有可能实现两种接口的方法
+	if s, ok := c.(stringer); ok {
+		return s.String()
+	}
+	return reflect.TypeOf(c).String()
+}
+
+// 这个和 withcancel 取反
+// 结构为:
+//
+//	1
+//
+// 2 2 2 2 2 2
+func WithoutCancel(parent Context) Context {
+	if parent == nil {
+		panic("cannot create context from nil parent")
+	}
+	return hooked(withoutCancelCtx{parent})
+}
+
+type withoutCancelCtx struct {
+	c Context
+}
+
+func (withoutCancelCtx) Deadline() (deadline time.Time, ok bool) {
+	return
+}
+
+func (withoutCancelCtx) Done() <-chan struct{} {
+	return nil
+}
+
+func (withoutCancelCtx) Err() error {
+	return nil
+}
+
+func (c withoutCancelCtx) Value(key any) any {
+	return value(c, key)
+}
+
+func (c withoutCancelCtx) String() string {
+	return contextName(c.c) + ".WithoutCancel"
+}
+
+// Detach 和WithoutCancel差不多。 parent取消了它不跟着取消。 值照样能查到
+// 区别是parent的截止日期留着。 到点了还是会以DeadlineExceeded结束。 用在发出去不管但是不能超时的活
+// 返回的取消函数和WithCancel的一样。 活干完了要调。 不然parent的截止日期很远的话定时器要一直挂到那时候
+func Detach(parent Context) (Context, CancelFunc) {
+	c := WithoutCancel(parent)
+	if d, ok := parent.Deadline(); ok {
+		return WithDeadline(c, d)
+	}
+	return WithCancel(c)
+}
+
+// WithName 给ctx起个名字。自动生成的String()太长了。日志里不好看
+// 除了String() 其他的方法全部交给parent
+func WithName(parent Context, name string) Context {
+	if parent == nil {
+		panic("cannot create context from nil parent")
+	}
+	return hooked(&nameCtx{parent, name})
+}
+
+type nameCtx struct {
+	Context
+	name string
+}
+
+// 名字后面带上parent的简称。知道挂在谁下面
+func (c *nameCtx) String() string {
+	return c.name + "(" + shortName(c.Context) + ")"
+}
+
+// Name 往上找最近的WithName起的名字。 一个都没有返回false
+// 别的地方(DumpTree 泄漏报告)要显示名字的时候用它
+func Name(ctx Context) (string, bool) {
+	for c := ctx; c != nil; c = parentOf(c) {
+		if n, ok := c.(*nameCtx); ok {
+			return n.name, true
+		}
+		if b, ok := c.(*builtCtx); ok && b.name != "" {
+			return b.name, true
+		}
+	}
+	return "", false
+}
+
+// shortName 只取最后一段。比如 context.Background.WithCancel 只取 WithCancel
+func shortName(c Context) string {
+	s := contextName(c)
+	if _, ok := c.(*nameCtx); ok {
+		return s
+	}
+	if b, ok := c.(*builtCtx); ok && b.name != "" {
+		return s
+	}
+	if i := strings.IndexByte(s, '('); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.LastIndexByte(s, '.'); i >= 0 {
+		s = s[i+1:]
+	}
+	return s
+}
+
+// Cause 查看这个context被取消的原因
+func Cause(c Context) error {
+	if cc, ok := c.Value(&cancelCtxKey).(*cancelCtx); ok {
+		return cc.loadCause()
+	}
+	return c.Err()
+}
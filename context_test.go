@@ -0,0 +1,140 @@
+package context
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWithNameInDumpTree(t *testing.T) {
+	req := WithName(Background(), "req")
+	ctx, cancel := WithCancel(req)
+	defer cancel()
+	db := WithName(ctx, "db")
+
+	want := "context.Background\n" +
+		"  req\n" +
+		"    WithCancel\n" +
+		"      db <-\n"
+	if got := DumpTree(db); got != want {
+		t.Fatalf("DumpTree =\n%s\nwant\n%s", got, want)
+	}
+	if got := contextName(ctx); got != "req.WithCancel" {
+		t.Errorf("contextName = %q, want req.WithCancel", got)
+	}
+	if db.Done() != ctx.Done() {
+		t.Error("WithName does not pass Done through")
+	}
+}
+
+func TestDumpTreeDOT(t *testing.T) {
+	req := WithName(Background(), "req")
+	ctx, cancel := WithCancel(req)
+	defer cancel()
+	db := WithName(ctx, "db")
+	// 兄弟节点也画出来。 ctx自己那个加粗
+	_, cancelSib := WithCancel(ctx)
+	defer cancelSib()
+
+	want := "digraph context {\n" +
+		"\tnode [shape=box];\n" +
+		"\tn0 [label=\"context.Background\"];\n" +
+		"\tn1 [label=\"req\"];\n" +
+		"\tn2 [label=\"WithCancel\"];\n" +
+		"\tn3 [label=\"WithCancel\"];\n" +
+		"\tn2 -> n3;\n" +
+		"\tn4 [label=\"db\", style=bold];\n" +
+		"\tn2 -> n4;\n" +
+		"\tn1 -> n2;\n" +
+		"\tn0 -> n1;\n" +
+		"}\n"
+	if got := DumpTreeDOT(db); got != want {
+		t.Fatalf("DumpTreeDOT =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestErrorMessages(t *testing.T) {
+	defer func() { CanceledMessage, DeadlineMessage = nil, nil }()
+	CanceledMessage = func() string { return "已取消" }
+	DeadlineMessage = func() string { return "已超时" }
+
+	ctx, cancel := WithCancel(Background())
+	cancel()
+	err := ctx.Err()
+	if got := err.Error(); got != "已取消" {
+		t.Errorf("Canceled.Error() = %q, want %q", got, "已取消")
+	}
+	if !errors.Is(err, Canceled) || errors.Is(err, DeadlineExceeded) {
+		t.Errorf("errors.Is(%v, Canceled) should be the only match", err)
+	}
+
+	ctx, cancel = WithTimeout(Background(), 0)
+	defer cancel()
+	err = ctx.Err()
+	if got := err.Error(); got != "已超时" {
+		t.Errorf("DeadlineExceeded.Error() = %q, want %q", got, "已超时")
+	}
+	if !errors.Is(err, DeadlineExceeded) || errors.Is(err, Canceled) {
+		t.Errorf("errors.Is(%v, DeadlineExceeded) should be the only match", err)
+	}
+
+	// 换回nil就是默认的
+	CanceledMessage = nil
+	if got := Canceled.Error(); got != "context canceled" {
+		t.Errorf("default Canceled.Error() = %q, want %q", got, "context canceled")
+	}
+}
+
+func TestDetach(t *testing.T) {
+	parent, cancelParent := WithTimeout(WithValue(Background(), "k", 1), time.Hour)
+	want, _ := parent.Deadline()
+	ctx, cancel := Detach(parent)
+	defer cancel()
+
+	if got := ctx.Value("k"); got != 1 {
+		t.Errorf("Value(k) = %v, want 1", got)
+	}
+	if got, ok := ctx.Deadline(); !ok || !got.Equal(want) {
+		t.Errorf("Deadline() = %v, %v, want %v, true", got, ok, want)
+	}
+	// parent取消了它不跟着取消
+	cancelParent()
+	if err := ctx.Err(); err != nil {
+		t.Fatalf("Err() after parent cancel = %v, want nil", err)
+	}
+	// 取消函数把定时器也停掉
+	cancel()
+	if err := ctx.Err(); err != Canceled {
+		t.Errorf("Err() after cancel = %v, want %v", err, Canceled)
+	}
+	if tc, ok := ctx.(*timerCtx); !ok {
+		t.Errorf("Detach of a deadline parent = %T, want *timerCtx", ctx)
+	} else if tc.timer != nil {
+		t.Error("timer still armed after cancel")
+	}
+
+	// parent的截止日期照样会到
+	short, cancelShort := WithTimeout(Background(), time.Millisecond)
+	defer cancelShort()
+	ctx, cancel = Detach(short)
+	defer cancel()
+	<-ctx.Done()
+	if err := ctx.Err(); err != DeadlineExceeded {
+		t.Errorf("Err() at the parent deadline = %v, want %v", err, DeadlineExceeded)
+	}
+
+	// 没有截止日期的parent
+	plain, cancelPlain := WithCancel(Background())
+	ctx, cancel = Detach(plain)
+	cancelPlain()
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("Detach of a parent without deadline has a deadline")
+	}
+	if err := ctx.Err(); err != nil {
+		t.Errorf("Err() after parent cancel = %v, want nil", err)
+	}
+	cancel()
+	if err := ctx.Err(); err != Canceled {
+		t.Errorf("Err() after cancel = %v, want %v", err, Canceled)
+	}
+}
@@ -0,0 +1,50 @@
+// Package ctxdebug 把还活着的ctx用http页面显示出来。 和/debug/pprof一个意思
+//
+//	context.TrackLive = true
+//	http.Handle("/debug/contexts", ctxdebug.Handler())
+//
+// 单独放一个包。 不想用的话主包就不用依赖net/http
+package ctxdebug
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/qingyun-007/context"
+)
+
+// Handler 每次请求把context.LiveContexts()打印成纯文本。 最老的在最前面
+// ?stack=1 的话把创建的位置也打出来(要打开context.RecordCreationStack)
+func Handler() http.Handler {
+	return http.HandlerFunc(serve)
+}
+
+func serve(w http.ResponseWriter, r *http.Request) {
+	infos := context.LiveContexts()
+	withStack := r.FormValue("stack") == "1"
+	var b strings.Builder
+	if !context.TrackLive {
+		b.WriteString("context.TrackLive is off; only contexts created while it was on are listed\n\n")
+	}
+	b.WriteString("live contexts: " + strconv.Itoa(len(infos)) + "\n\n")
+	now := time.Now()
+	for _, info := range infos {
+		b.WriteString(info.Name + "\n")
+		b.WriteString("\tage: " + info.Age.Round(time.Millisecond).String() + "\n")
+		if !info.Deadline.IsZero() {
+			b.WriteString("\tdeadline: " + info.Deadline.Format(time.RFC3339Nano) +
+				" (in " + info.Deadline.Sub(now).Round(time.Millisecond).String() + ")\n")
+		}
+		if info.Parent != "" {
+			b.WriteString("\tparent: " + info.Parent + "\n")
+		}
+		if withStack && info.Stack != "" {
+			b.WriteString("\tstack:\n\t\t" + strings.ReplaceAll(info.Stack, "\n", "\n\t\t") + "\n")
+		}
+		b.WriteByte('\n')
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
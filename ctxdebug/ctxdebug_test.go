@@ -0,0 +1,43 @@
+package ctxdebug
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qingyun-007/context"
+)
+
+func TestHandler(t *testing.T) {
+	context.TrackLive = true
+	context.RecordCreationStack = true
+	defer func() { context.TrackLive, context.RecordCreationStack = false, false }()
+	_, cancel := context.WithTimeout(context.WithName(context.Background(), "debug-req"), time.Hour)
+
+	get := func(url string) string {
+		w := httptest.NewRecorder()
+		Handler().ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+			t.Errorf("Content-Type = %q, want text/plain", ct)
+		}
+		return w.Body.String()
+	}
+	body := get("/debug/contexts")
+	for _, want := range []string{"live contexts: 1\n", "\ndebug-req.WithDeadline(", "\tdeadline: ", "\tparent: debug-req\n"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body missing %q:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "\tstack:") {
+		t.Errorf("stack printed without ?stack=1:\n%s", body)
+	}
+	if body := get("/debug/contexts?stack=1"); !strings.Contains(body, "TestHandler") {
+		t.Errorf("?stack=1 body has no creation stack:\n%s", body)
+	}
+
+	cancel()
+	if body := get("/debug/contexts"); strings.Contains(body, "debug-req") {
+		t.Errorf("canceled ctx still listed:\n%s", body)
+	}
+}
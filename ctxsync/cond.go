@@ -0,0 +1,71 @@
+package ctxsync
+
+import (
+	"sync"
+
+	"github.com/qingyun-007/context"
+)
+
+// Cond 和sync.Cond一样。 只是Wait能被ctx打断
+// 每个等的人一个自己的channel。 Signal按先来先到叫醒一个。 Broadcast全叫醒
+type Cond struct {
+	L sync.Locker
+
+	mu      sync.Mutex
+	waiters []chan struct{}
+}
+
+// NewCond 和sync.NewCond一样
+func NewCond(l sync.Locker) *Cond {
+	return &Cond{L: l}
+}
+
+// Wait 调之前要拿着c.L。 和sync.Cond一样。 等的时候放开。 返回之前一定重新拿回来
+// 被Signal Broadcast叫醒返回nil。 ctx先结束了返回context.Cause(ctx)
+// 叫醒和ctx结束差不多同时发生的话算叫醒。 不然这次Signal就被吞掉了。 别的等的人也收不到
+func (c *Cond) Wait(ctx context.Context) error {
+	ch := make(chan struct{}, 1)
+	c.mu.Lock()
+	c.waiters = append(c.waiters, ch)
+	c.mu.Unlock()
+
+	c.L.Unlock()
+	defer c.L.Lock()
+
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, w := range c.waiters {
+		if w == ch {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			return context.Cause(ctx)
+		}
+	}
+	// 不在队里了。 说明刚刚被叫醒过
+	return nil
+}
+
+// Signal 叫醒等得最久的那一个。 没人等就什么都不做
+func (c *Cond) Signal() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.waiters) == 0 {
+		return
+	}
+	c.waiters[0] <- struct{}{}
+	c.waiters = c.waiters[1:]
+}
+
+// Broadcast 全部叫醒
+func (c *Cond) Broadcast() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, w := range c.waiters {
+		w <- struct{}{}
+	}
+	c.waiters = nil
+}
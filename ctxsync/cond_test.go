@@ -0,0 +1,82 @@
+package ctxsync
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/qingyun-007/context"
+)
+
+// TestCondCancelRacesSignal A的取消和一次Signal(或者Broadcast)同时来。 B一直在等
+// Signal: A拿到了就要返回nil。 B不能被叫醒。 A算取消的话这次Signal一定要落到B身上
+// Broadcast: A怎么算都行。 B一定醒
+func TestCondCancelRacesSignal(t *testing.T) {
+	for i := range 400 {
+		broadcast := i%2 == 1
+		var mu sync.Mutex
+		c := NewCond(&mu)
+		ctxA, cancelA := context.WithCancel(context.Background())
+		resA, resB := make(chan error, 1), make(chan error, 1)
+		wait := func(ctx context.Context, res chan<- error) {
+			mu.Lock()
+			res <- c.Wait(ctx)
+			mu.Unlock()
+		}
+		go wait(ctxA, resA)
+		for waiters(c) < 1 {
+			time.Sleep(time.Microsecond)
+		}
+		go wait(context.Background(), resB)
+		for waiters(c) < 2 {
+			time.Sleep(time.Microsecond)
+		}
+
+		go cancelA()
+		if broadcast {
+			c.Broadcast()
+		} else {
+			c.Signal()
+		}
+		var errA error
+		select {
+		case errA = <-resA:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("round %d: A never returned", i)
+		}
+		switch errA {
+		case nil:
+			if broadcast {
+				break
+			}
+			// A拿了这次Signal。 B还得等下一次
+			time.Sleep(time.Millisecond)
+			select {
+			case <-resB:
+				t.Fatalf("round %d: one Signal woke both waiters", i)
+			default:
+			}
+			c.Signal()
+		case context.Canceled:
+		default:
+			t.Fatalf("round %d: A Wait() = %v, want nil or %v", i, errA, context.Canceled)
+		}
+		select {
+		case err := <-resB:
+			if err != nil {
+				t.Fatalf("round %d: B Wait() = %v, want nil", i, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("round %d: Signal lost, B never woke (A returned %v)", i, errA)
+		}
+		if n := waiters(c); n != 0 {
+			t.Fatalf("round %d: %d waiters left in the queue", i, n)
+		}
+	}
+}
+
+func waiters(c *Cond) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
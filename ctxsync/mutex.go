@@ -0,0 +1,56 @@
+// Package ctxsync 是能被ctx打断的sync。 等锁、等WaitGroup、等Cond的时候ctx取消了就不等了
+// 取消了的请求还卡在sync.Mutex上。 协程就一直堆着。 这里的都返回context.Cause(ctx)
+package ctxsync
+
+import (
+	"sync"
+
+	"github.com/qingyun-007/context"
+)
+
+// Mutex 零值就能用。 用完不要复制
+// 用一个容量1的channel当锁。 这样等锁的时候能和ctx.Done()一起select
+type Mutex struct {
+	once sync.Once
+	ch   chan struct{}
+}
+
+func (m *Mutex) init() {
+	m.once.Do(func() { m.ch = make(chan struct{}, 1) })
+}
+
+// Lock 拿到锁返回nil。 ctx先结束了就不等了。 返回context.Cause(ctx)。 这时候没有拿到锁
+// ctx已经结束了的话。 锁空着也不拿
+func (m *Mutex) Lock(ctx context.Context) error {
+	m.init()
+	if ctx.Err() != nil {
+		return context.Cause(ctx)
+	}
+	select {
+	case m.ch <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
+
+// TryLock 不等。 拿到了返回true
+func (m *Mutex) TryLock() bool {
+	m.init()
+	select {
+	case m.ch <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Unlock 和sync.Mutex一样。 没锁着的时候Unlock会panic
+func (m *Mutex) Unlock() {
+	m.init()
+	select {
+	case <-m.ch:
+	default:
+		panic("ctxsync: unlock of unlocked mutex")
+	}
+}
@@ -0,0 +1,67 @@
+package ctxsync
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/qingyun-007/context"
+)
+
+func TestMutexLockCanceled(t *testing.T) {
+	var m Mutex
+	if err := m.Lock(context.Background()); err != nil {
+		t.Fatalf("Lock() = %v, want nil", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error)
+	go func() { errc <- m.Lock(ctx) }()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-errc:
+		if err != context.Canceled {
+			t.Fatalf("Lock() after cancel = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Lock() still blocked after cancel")
+	}
+	// 没拿到锁。 锁还是原来那个人的
+	if m.TryLock() {
+		t.Fatal("TryLock() = true while the mutex is still held")
+	}
+	m.Unlock()
+
+	// 有cause就返回cause
+	x := errors.New("x")
+	cctx, cancelCause := context.WithCancelCause(context.Background())
+	cancelCause(x)
+	if err := m.Lock(cctx); err != x {
+		t.Fatalf("Lock() on canceled ctx = %v, want %v", err, x)
+	}
+}
+
+func TestMutexTryLock(t *testing.T) {
+	var m Mutex
+	if !m.TryLock() {
+		t.Fatal("TryLock() on an unlocked mutex = false, want true")
+	}
+	if m.TryLock() {
+		t.Fatal("TryLock() on a locked mutex = true, want false")
+	}
+	m.Unlock()
+	if !m.TryLock() {
+		t.Fatal("TryLock() after Unlock = false, want true")
+	}
+	m.Unlock()
+}
+
+func TestMutexUnlockUnlocked(t *testing.T) {
+	var m Mutex
+	defer func() {
+		if recover() == nil {
+			t.Error("Unlock() of an unlocked mutex did not panic")
+		}
+	}()
+	m.Unlock()
+}
@@ -0,0 +1,55 @@
+package ctxsync
+
+import (
+	"sync"
+
+	"github.com/qingyun-007/context"
+)
+
+// WaitGroup 和sync.WaitGroup一样。 只是Wait能被ctx打断。 零值就能用。 用完不要复制
+type WaitGroup struct {
+	mu   sync.Mutex
+	n    int
+	done chan struct{} // closed when n drops to zero, created by the first Wait that has to block
+}
+
+// Add 和sync.WaitGroup一样。 减成负数会panic
+func (wg *WaitGroup) Add(delta int) {
+	wg.mu.Lock()
+	defer wg.mu.Unlock()
+	wg.n += delta
+	if wg.n < 0 {
+		panic("ctxsync: negative WaitGroup counter")
+	}
+	if wg.n == 0 && wg.done != nil {
+		close(wg.done)
+		wg.done = nil
+	}
+}
+
+// Done 就是Add(-1)
+func (wg *WaitGroup) Done() {
+	wg.Add(-1)
+}
+
+// Wait 等到计数变成0返回nil。 ctx先结束了就不等了。 返回context.Cause(ctx)
+// 计数已经是0的话。 不管ctx结束没有都返回nil
+func (wg *WaitGroup) Wait(ctx context.Context) error {
+	wg.mu.Lock()
+	if wg.n == 0 {
+		wg.mu.Unlock()
+		return nil
+	}
+	if wg.done == nil {
+		wg.done = make(chan struct{})
+	}
+	done := wg.done
+	wg.mu.Unlock()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
@@ -0,0 +1,56 @@
+package ctxsync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/qingyun-007/context"
+)
+
+func TestWaitGroupCanceled(t *testing.T) {
+	var wg WaitGroup
+	wg.Add(1)
+	defer wg.Done()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := wg.Wait(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Wait() = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestWaitGroupZero(t *testing.T) {
+	var wg WaitGroup
+	// 计数是0。 ctx结束了也是nil
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := wg.Wait(ctx); err != nil {
+		t.Fatalf("Wait() at zero = %v, want nil", err)
+	}
+
+	wg.Add(2)
+	for range 2 {
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			wg.Done()
+		}()
+	}
+	if err := wg.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait() = %v, want nil", err)
+	}
+	// 回到0之后能接着用
+	wg.Add(1)
+	go wg.Done()
+	if err := wg.Wait(context.Background()); err != nil {
+		t.Fatalf("second Wait() = %v, want nil", err)
+	}
+}
+
+func TestWaitGroupNegative(t *testing.T) {
+	var wg WaitGroup
+	defer func() {
+		if recover() == nil {
+			t.Error("Done() below zero did not panic")
+		}
+	}()
+	wg.Done()
+}
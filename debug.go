@@ -0,0 +1,263 @@
+package context
+
+import (
+	"errors"
+	"time"
+)
+
+// SubtreeSize 数一下ctx背后的cancelCtx下面还活着的节点有多少个。 包括它自己。 已经取消了就是0
+// 加锁顺序: 先在自己的锁里把孩子抄一份。 放开锁之后再一个个去数孩子
+// 不会拿着parent的锁去拿孩子的锁。 因为孩子取消的时候要反过来拿parent的锁去removeChild
+func SubtreeSize(ctx Context) int {
+	c, ok := ctx.Value(&cancelCtxKey).(*cancelCtx)
+	if !ok {
+		return 0
+	}
+	return subtreeSize(c)
+}
+
+func subtreeSize(c *cancelCtx) int {
+	if c.Err() != nil {
+		return 0
+	}
+	children := c.childList()
+
+	n := 1
+	for _, child := range children {
+		cc, ok := child.(Context)
+		if !ok {
+			n++
+			continue
+		}
+		if own, ok := cc.Value(&cancelCtxKey).(*cancelCtx); ok {
+			n += subtreeSize(own)
+		}
+	}
+	return n
+}
+
+// CheckInvariants 检查ctx背后的cancelCtx以及它下面整棵树是不是都对。 给测试用的
+// 取消了的: done一定关了。 err cause都不是nil。 children清空了
+// 没取消的: err cause都是nil。 done没关。 每个孩子往上找到的cancelCtx都是自己
+func CheckInvariants(ctx Context) error {
+	c, ok := ctx.Value(&cancelCtxKey).(*cancelCtx)
+	if !ok {
+		return nil
+	}
+	return checkInvariants(c)
+}
+
+func checkInvariants(c *cancelCtx) error {
+	// 状态 done 孩子要在同一把锁里一起看。 不然看完err到看done中间timer可能刚好把它取消了
+	// 分片的锁本来就是拿着c.mu去拿的。 和取消的时候一样
+	c.mu.Lock()
+	err, cause := c.Err(), c.loadCause()
+	closed := false
+	if d, _ := c.done.Load().(chan struct{}); d != nil {
+		select {
+		case <-d:
+			closed = true
+		default:
+		}
+	}
+	children := append([]canceler(nil), c.few[:c.nfew.Load()]...)
+	if s := c.kids.Load(); s != nil {
+		children = append(children, s.snapshot()...)
+	}
+	c.mu.Unlock()
+
+	name := contextName(c)
+	if err != nil {
+		if !closed {
+			return errors.New(name + ": canceled but done is not closed")
+		}
+		if cause == nil {
+			return errors.New(name + ": canceled with nil cause")
+		}
+		if len(children) > 0 {
+			return errors.New(name + ": canceled but still has children")
+		}
+		return nil
+	}
+	if cause != nil {
+		return errors.New(name + ": live but cause is set")
+	}
+	if closed {
+		return errors.New(name + ": live but done is closed")
+	}
+
+	// 不在锁里往下查。 不然就是拿着parent的锁去拿孩子的锁。 孩子那边取消的时候要反过来拿parent的锁
+	for _, child := range children {
+		cc, ok := child.(Context)
+		if !ok {
+			continue
+		}
+		own, ok := cc.Value(&cancelCtxKey).(*cancelCtx)
+		if !ok {
+			return errors.New(name + ": child has no cancelCtx")
+		}
+		if up, _ := own.parent().Value(&cancelCtxKey).(*cancelCtx); up != c {
+			return errors.New(contextName(own) + ": registered under " + name + " but that is not its parent")
+		}
+		if err := checkInvariants(own); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parentOf 找到c的parent。 根节点或者不认识的ctx(别人自己实现的)返回nil
+// 中间的stopCtx是内部用的。 直接跳过
+func parentOf(c Context) Context {
+	var p Context
+	switch ctx := c.(type) {
+	case *valueCtx:
+		p = ctx.Context
+	case *cancelCtx:
+		p = ctx.parent()
+	case *timerCtx:
+		p = ctx.parent()
+	case *lazyTimerCtx:
+		p = ctx.parent()
+	case *idleCtx:
+		p = ctx.parent()
+	case withoutCancelCtx:
+		p = ctx.c
+	case *nameCtx:
+		p = ctx.Context
+	case *logFieldsCtx:
+		p = ctx.Context
+	case *filterCtx:
+		p = ctx.Context
+	case *ttlValueCtx:
+		p = ctx.Context
+	case *valuesCtx:
+		p = ctx.Context
+	case *lazyValueCtx:
+		p = ctx.Context
+	case *withoutValueCtx:
+		p = ctx.Context
+	case *stackCtx:
+		p = ctx.Context
+	case *parentAwareCtx:
+		p = ctx.parent()
+	case *mergeCtx:
+		p = ctx.parent()
+	case *parentsCtx:
+		p = ctx.parent()
+	case *builtCtx:
+		p = ctx.parent()
+	case *flatCtx:
+		p = ctx.Context
+	case *ackCtx:
+		p = ctx.parent()
+	case *graceCtx:
+		p = ctx.parent()
+	}
+	if s, ok := p.(stopCtx); ok {
+		p = s.Context
+	}
+	return p
+}
+
+// Depth ctx和根之间隔了几层包装
+// Background() TODO() 自己是0。 别人自己实现的ctx看不到它的parent。 就当它是根
+func Depth(ctx Context) int {
+	n := 0
+	for p := parentOf(ctx); p != nil; p = parentOf(p) {
+		n++
+	}
+	return n
+}
+
+// RootKind 一路往上找到根。 看看是 "Background" "TODO" 还是 "Empty"
+// 用来检查线上代码是不是不小心用了TODO()。 根是别人自己实现的ctx的话返回 "Unknown"
+func RootKind(ctx Context) string {
+	root := ctx
+	for p := parentOf(ctx); p != nil; p = parentOf(p) {
+		root = p
+	}
+	switch root.(type) {
+	case backgroundCtx:
+		return "Background"
+	case todoCtx:
+		return "TODO"
+	case emptyCtx:
+		return "Empty"
+	}
+	return "Unknown"
+}
+
+// ShadowedKeys 找出在链上存了不止一次的key。 也就是外面的WithValue把里面的盖住了
+// 按离ctx最近的那次出现的顺序返回
+func ShadowedKeys(ctx Context) []any {
+	var keys []any
+	count := make(map[any]int)
+	for c := ctx; c != nil; c = parentOf(c) {
+		eachValue(c, func(key, _ any) {
+			count[key]++
+			if count[key] == 2 {
+				keys = append(keys, key)
+			}
+		})
+	}
+	return keys
+}
+
+// eachValue 把这个节点自己存的值一个一个交给f。 不往parent找。 过期了的TTL值不算
+// WithValueFunc的值还没算过的话。 这时候会算出来
+func eachValue(c Context, f func(key, val any)) {
+	switch v := c.(type) {
+	case *valueCtx:
+		f(v.key, v.val)
+	case *flatCtx:
+		// 索引里的是抄上面的。 不算它自己存的
+		f(v.key, v.val)
+	case *ttlValueCtx:
+		if time.Since(v.created) < v.ttl {
+			f(v.key, v.val)
+		}
+	case *valuesCtx:
+		for key, val := range v.vals {
+			f(key, val)
+		}
+	case *lazyValueCtx:
+		f(v.key, v.get())
+	case *withoutValueCtx:
+		// 藏起来的key当成存了个nil。 这样Snapshot也不会把上面的值拍进去
+		f(v.key, nil)
+	case *builtCtx:
+		// 后存的先给。 和查值的时候一样
+		for i := len(v.kv) - 2; i >= 0; i -= 2 {
+			f(v.kv[i], v.kv[i+1])
+		}
+	}
+}
+
+// Snapshot 把ctx现在的所有值拍个快照。 挂到一个全新的可取消的ctx上面
+// 新ctx和原来的ctx生命周期没有关系。 谁取消都不影响对方
+// 同一个key存了好几次的。 以最里面(离ctx最近)的为准
+// 只能看到这个包里的ctx存的值。 遇到别人自己实现的ctx就停下来了
+func Snapshot(ctx Context) (Context, CancelFunc) {
+	type pair struct{ key, val any }
+	var pairs []pair
+	seen := make(map[any]bool)
+	for c := ctx; c != nil; c = parentOf(c) {
+		eachValue(c, func(key, val any) {
+			if !seen[key] {
+				seen[key] = true
+				pairs = append(pairs, pair{key, val})
+			}
+		})
+	}
+
+	snap, cancel := WithCancel(Background())
+	if fields := LogFields(ctx); len(fields) > 0 {
+		snap = WithLogFields(snap, fields)
+	}
+	// 从外往里重新挂回去。 保持原来的顺序
+	for i := len(pairs) - 1; i >= 0; i-- {
+		snap = &valueCtx{snap, pairs[i].key, pairs[i].val}
+	}
+	return snap, cancel
+}
@@ -0,0 +1,181 @@
+package context
+
+import (
+	"testing"
+	"time"
+)
+
+// FuzzInvariants 按data一步步建树、取消。 每一步之后整棵树都要满足CheckInvariants
+// 每两个字节一步: 第一个决定做什么。 第二个决定在哪个节点上做
+func FuzzInvariants(f *testing.F) {
+	f.Add([]byte{0, 0, 0, 1, 1, 0, 3, 1, 2, 2, 3, 0})
+	f.Add([]byte{1, 0, 1, 1, 0, 2, 4, 0, 3, 3, 3, 2})
+	f.Add([]byte{0, 0, 0, 0, 0, 1, 0, 2, 3, 1, 0, 3, 3, 0})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		root, cancelRoot := WithCancel(Background())
+		nodes := []Context{root}
+		cancels := []CancelFunc{cancelRoot}
+		for i := 0; i+1 < len(data); i += 2 {
+			at := int(data[i+1]) % len(nodes)
+			parent := nodes[at]
+			switch data[i] % 5 {
+			case 0:
+				ctx, cancel := WithCancel(parent)
+				nodes, cancels = append(nodes, ctx), append(cancels, cancel)
+			case 1:
+				ctx, cancel := WithTimeout(parent, time.Duration(data[i+1]%4)*time.Microsecond)
+				nodes, cancels = append(nodes, ctx), append(cancels, cancel)
+			case 2:
+				nodes, cancels = append(nodes, WithValue(parent, at, i)), append(cancels, func() {})
+			case 3:
+				cancels[at]()
+			case 4:
+				time.Sleep(time.Microsecond)
+			}
+			for _, n := range nodes {
+				if err := CheckInvariants(n); err != nil {
+					t.Fatalf("step %d: %v", i/2, err)
+				}
+			}
+		}
+
+		cancelRoot()
+		for _, n := range nodes {
+			if n.Err() == nil {
+				t.Fatalf("%v still live after the root was canceled", n)
+			}
+			if err := CheckInvariants(n); err != nil {
+				t.Fatalf("after root cancel: %v", err)
+			}
+		}
+		for _, cancel := range cancels {
+			cancel()
+		}
+	})
+}
+
+func TestSnapshot(t *testing.T) {
+	orig, cancelOrig := WithCancel(WithValue(WithValue(Background(), "k", "outer"), "k", "inner"))
+	snap, cancelSnap := Snapshot(WithValue(orig, "x", 1))
+	if got := snap.Value("k"); got != "inner" {
+		t.Errorf(`Value("k") = %v, want inner`, got)
+	}
+	if got := snap.Value("x"); got != 1 {
+		t.Errorf(`Value("x") = %v, want 1`, got)
+	}
+
+	cancelOrig()
+	if err := snap.Err(); err != nil {
+		t.Fatalf("canceling the original canceled the snapshot: %v", err)
+	}
+	cancelSnap()
+	if snap.Err() != Canceled {
+		t.Fatalf("snapshot Err() = %v, want %v", snap.Err(), Canceled)
+	}
+
+	orig, cancelOrig = WithCancel(Background())
+	defer cancelOrig()
+	_, cancelSnap = Snapshot(orig)
+	cancelSnap()
+	if err := orig.Err(); err != nil {
+		t.Fatalf("canceling the snapshot canceled the original: %v", err)
+	}
+}
+
+func TestDepth(t *testing.T) {
+	bg := Background()
+	c1, cancel1 := WithCancel(bg)
+	defer cancel1()
+	t1, cancelT := WithTimeout(WithValue(c1, "k", 1), time.Hour)
+	defer cancelT()
+	for _, tt := range []struct {
+		ctx  Context
+		want int
+	}{
+		{bg, 0},
+		{TODO(), 0},
+		{WithValue(bg, "k", 1), 1},
+		{c1, 1},
+		{WithoutCancel(c1), 2},
+		{WithValue(WithoutCancel(WithValue(bg, "a", 1)), "b", 2), 3},
+		{t1, 3},
+	} {
+		if got := Depth(tt.ctx); got != tt.want {
+			t.Errorf("Depth(%v) = %d, want %d", tt.ctx, got, tt.want)
+		}
+	}
+}
+
+func TestRootKind(t *testing.T) {
+	custom, cancelCustom := newAfterFuncParent()
+	defer cancelCustom(nil)
+	// 每种根上面都套几层。 要一路找到底
+	wrap := func(root Context) Context {
+		c, cancel := WithCancel(WithValue(root, "k", 1))
+		t.Cleanup(cancel)
+		tc, cancelT := WithTimeout(WithoutCancel(c), time.Hour)
+		t.Cleanup(cancelT)
+		return WithName(tc, "req")
+	}
+	for _, tt := range []struct {
+		root Context
+		want string
+	}{
+		{Background(), "Background"},
+		{TODO(), "TODO"},
+		{emptyCtx{}, "Empty"},
+		{custom, "Unknown"},
+	} {
+		if got := RootKind(tt.root); got != tt.want {
+			t.Errorf("RootKind(%v) = %q, want %q", tt.root, got, tt.want)
+		}
+		if got := RootKind(wrap(tt.root)); got != tt.want {
+			t.Errorf("RootKind(wrapped %v) = %q, want %q", tt.root, got, tt.want)
+		}
+	}
+}
+
+func TestShadowedKeys(t *testing.T) {
+	ctx := WithValue(Background(), "k", 1)
+	ctx = WithValue(ctx, "other", 2)
+	c, cancel := WithCancel(ctx)
+	defer cancel()
+	ctx = WithValue(c, "k", 3)
+	got := ShadowedKeys(ctx)
+	if len(got) != 1 || got[0] != "k" {
+		t.Errorf("ShadowedKeys() = %v, want [k]", got)
+	}
+	if got := ShadowedKeys(WithValue(Background(), "k", 1)); len(got) != 0 {
+		t.Errorf("ShadowedKeys(no shadowing) = %v, want none", got)
+	}
+}
+
+func TestSubtreeSize(t *testing.T) {
+	root, cancelRoot := WithCancel(Background())
+	defer cancelRoot()
+	a, cancelA := WithCancel(root)
+	defer cancelA()
+	_, cancelB := WithTimeout(root, time.Hour)
+	defer cancelB()
+	_, cancelGrand := WithCancel(WithValue(a, "k", 1))
+	defer cancelGrand()
+
+	if got := SubtreeSize(root); got != 4 {
+		t.Errorf("SubtreeSize(root) = %d, want 4", got)
+	}
+	cancelGrand()
+	if got := SubtreeSize(root); got != 3 {
+		t.Errorf("after canceling the grandchild: SubtreeSize(root) = %d, want 3", got)
+	}
+	cancelA()
+	if got := SubtreeSize(root); got != 2 {
+		t.Errorf("after canceling a: SubtreeSize(root) = %d, want 2", got)
+	}
+	cancelRoot()
+	if got := SubtreeSize(root); got != 0 {
+		t.Errorf("after canceling root: SubtreeSize(root) = %d, want 0", got)
+	}
+	if got := SubtreeSize(Background()); got != 0 {
+		t.Errorf("SubtreeSize(Background()) = %d, want 0", got)
+	}
+}
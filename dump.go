@@ -0,0 +1,189 @@
+package context
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DumpTree 把ctx所在的树打印出来。 调试"到底是谁把我的ctx取消了"用的
+// 先从根一路打印到ctx。 路上的cancelCtx还会往下把挂在它下面的孩子也打印出来
+// 每个节点一行: 是什么ctx。 截止日期。 err和cause。 ctx自己那一行末尾标了 <-
+// 只认识这个包里的ctx。 遇到别人自己实现的ctx就当它是根
+// 锁的顺序和SubtreeSize一样。 不会拿着parent的锁去拿孩子的锁
+func DumpTree(ctx Context) string {
+	var b strings.Builder
+	var walk func(n *dumpNode, depth int)
+	walk = func(n *dumpNode, depth int) {
+		b.WriteString(strings.Repeat("  ", depth))
+		b.WriteString(n.label)
+		if n.here {
+			b.WriteString(" <-")
+		}
+		b.WriteByte('\n')
+		for _, k := range n.kids {
+			walk(k, depth+1)
+		}
+	}
+	walk(dumpTree(ctx), 0)
+	return b.String()
+}
+
+// DumpTreeDOT 和DumpTree一样。 只是输出Graphviz的DOT格式。 ctx自己那个节点是加粗的
+func DumpTreeDOT(ctx Context) string {
+	var b strings.Builder
+	b.WriteString("digraph context {\n\tnode [shape=box];\n")
+	id := 0
+	var walk func(n *dumpNode) string
+	walk = func(n *dumpNode) string {
+		name := "n" + strconv.Itoa(id)
+		id++
+		b.WriteString("\t" + name + " [label=" + strconv.Quote(n.label))
+		if n.here {
+			b.WriteString(", style=bold")
+		}
+		b.WriteString("];\n")
+		for _, k := range n.kids {
+			b.WriteString("\t" + name + " -> " + walk(k) + ";\n")
+		}
+		return name
+	}
+	walk(dumpTree(ctx))
+	b.WriteString("}\n")
+	return b.String()
+}
+
+type dumpNode struct {
+	label string
+	here  bool
+	kids  []*dumpNode
+}
+
+// dumpTree 先把树搭出来。 文本和DOT共用
+func dumpTree(ctx Context) *dumpNode {
+	var chain []Context
+	for c := ctx; c != nil; c = parentOf(c) {
+		chain = append(chain, c)
+	}
+	// 倒过来。 根在最前面
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+
+	var root, prev *dumpNode
+	for _, c := range chain {
+		n := &dumpNode{label: dumpLabel(c)}
+		if prev == nil {
+			root = n
+		} else {
+			prev.kids = append(prev.kids, n)
+		}
+		// 链上的节点下面还会再出现一次。 这里跳过
+		for _, child := range dumpChildren(c) {
+			if !inChain(chain, child) {
+				n.kids = append(n.kids, dumpSubtree(child, c))
+			}
+		}
+		prev = n
+	}
+	prev.here = true
+	return root
+}
+
+// dumpSubtree 从一个挂上来的孩子往下。 只能看到一层层挂上来的cancelCtx。 中间的WithValue这些看不到
+// 中间要是有WithName起的名字。 名字会带在孩子那一行上。 不然就看不到了
+func dumpSubtree(c, above Context) *dumpNode {
+	n := &dumpNode{label: dumpLabel(c)}
+	for p := parentOf(c); p != nil && p != above; p = parentOf(p) {
+		if nc, ok := p.(*nameCtx); ok {
+			n.label += " name=" + nc.name
+			break
+		}
+	}
+	for _, child := range dumpChildren(c) {
+		n.kids = append(n.kids, dumpSubtree(child, c))
+	}
+	return n
+}
+
+// dumpChildren c自己的cancelCtx下面挂着的孩子。 c不是cancelCtx这一类的就没有
+// 抄一份。 按名字排个序。 每次打印出来都一样
+func dumpChildren(c Context) []Context {
+	cc, ok := c.Value(&cancelCtxKey).(*cancelCtx)
+	if !ok || cc.self == nil || any(cc.self) != any(c) {
+		return nil
+	}
+	var kids []Context
+	for _, child := range cc.childList() {
+		if k, ok := child.(Context); ok {
+			kids = append(kids, k)
+		}
+	}
+	sort.Slice(kids, func(i, j int) bool {
+		return contextName(kids[i]) < contextName(kids[j])
+	})
+	return kids
+}
+
+// inChain children的key一定能比较。 所以这里的==不会panic
+func inChain(chain []Context, c Context) bool {
+	for _, n := range chain {
+		if n == c {
+			return true
+		}
+	}
+	return false
+}
+
+// dumpLabel 一个节点的说明。 String()里面去掉parent的那一截。 只留它自己
+func dumpLabel(c Context) string {
+	s := contextName(c)
+	if n, ok := c.(*nameCtx); ok {
+		s = n.name
+	} else if parentOf(c) != nil {
+		s = ownPart(s)
+	}
+	if d, ok := c.Deadline(); ok {
+		s += " deadline=" + d.Format(time.RFC3339Nano)
+	}
+	if err := c.Err(); err != nil {
+		s += " err=" + err.Error()
+		if cause := Cause(c); cause != nil && cause != err {
+			s += " cause=" + cause.Error()
+		}
+	}
+	if at := ownStack(c); at != "" {
+		// 只要第一行。 也就是建它的那个位置
+		if i := strings.IndexByte(at, '\n'); i >= 0 {
+			at = at[:i]
+		}
+		s += " created=" + at
+	}
+	return s
+}
+
+// ownPart 从String()里切出最后一截 .WithXxx(...)
+// 不能拿parent的String()去当前缀切。 WithDeadline的String()里有剩余时间。 每次算都不一样
+func ownPart(s string) string {
+	end := len(s)
+	if strings.HasSuffix(s, ")") {
+		depth := 0
+		for i := len(s) - 1; i >= 0; i-- {
+			switch s[i] {
+			case ')':
+				depth++
+			case '(':
+				depth--
+			}
+			if depth == 0 {
+				end = i
+				break
+			}
+		}
+	}
+	if i := strings.LastIndexByte(s[:end], '.'); i >= 0 {
+		return s[i+1:]
+	}
+	return s
+}
@@ -0,0 +1,97 @@
+package context
+
+import "reflect"
+
+// FlattenDepth 大于0的时候打开值索引
+// WithValue的时候往上数。 能直接看穿的节点连着超过FlattenDepth个的话。 新节点上会建一个map
+// 把上面这一段存的值全抄进去。 以后查值一次map就够了。 不用一层一层往上跳
+// 代价是建节点的时候要抄一遍。 链很深、查得又多的时候才划算
+var FlattenDepth int
+
+// flatCtx 是对valueCtx的继承。 多了一个索引
+// index里是从parent到base之间所有节点存的值。 base往上的照常去找
+type flatCtx struct {
+	valueCtx
+	index map[any]any
+	base  Context
+}
+
+func (c *flatCtx) Value(key any) any {
+	if c.key == key {
+		hookLookup(c, key, true)
+		return c.val
+	}
+	// 内部用的key要一层层往上走。 不然找不到cancelCtx那些节点
+	if internalKey(key) {
+		return value(c.Context, key)
+	}
+	// 不能比较的key拿去查map会panic。 这种key本来也不可能存进来
+	if key != nil && reflect.TypeOf(key).Comparable() {
+		if v, ok := c.index[key]; ok {
+			hookLookup(c, key, true)
+			return v
+		}
+	}
+	return value(c.base, key)
+}
+
+// flatten 需要建索引的话返回flatCtx。 不需要返回nil
+func flatten(parent Context, key, val any) Context {
+	n := 0
+	for p := parent; n <= FlattenDepth; n++ {
+		next, ok := seeThrough(p)
+		if !ok {
+			break
+		}
+		p = next
+	}
+	if n <= FlattenDepth {
+		return nil
+	}
+
+	// 从近往远抄。 已经有的key不覆盖。 近的把远的盖住
+	index := make(map[any]any)
+	add := func(k, v any) {
+		if _, ok := index[k]; !ok {
+			index[k] = v
+		}
+	}
+	p := parent
+	for {
+		switch ctx := p.(type) {
+		case *valueCtx:
+			add(ctx.key, ctx.val)
+		case *valuesCtx:
+			for k, v := range ctx.vals {
+				add(k, v)
+			}
+		case *flatCtx:
+			// 上一个索引整个拿过来。 从它的base接着往上
+			add(ctx.key, ctx.val)
+			for k, v := range ctx.index {
+				add(k, v)
+			}
+			p = ctx.base
+			continue
+		}
+		next, ok := seeThrough(p)
+		if !ok {
+			break
+		}
+		p = next
+	}
+	return &flatCtx{valueCtx{parent, key, val}, index, p}
+}
+
+// seeThrough 查用户的key的时候。 p要么自己存着值(都能抄出来)。 要么直接交给parent
+// 这种节点返回它的parent。 别的(会藏值的 会过期的 别人自己实现的)返回false。 索引到这里就停了
+// 能取消的节点也停。 Reparent会换掉它们的parent。 抄下来的就是旧parent的值了
+func seeThrough(p Context) (Context, bool) {
+	switch ctx := p.(type) {
+	case *valueCtx, *valuesCtx, *nameCtx, *stackCtx, *logFieldsCtx, withoutCancelCtx:
+		return parentOf(ctx), parentOf(ctx) != nil
+	case *flatCtx:
+		return ctx.base, true
+	}
+	return nil, false
+}
@@ -0,0 +1,31 @@
+package context
+
+import "testing"
+
+func TestFlattenReparent(t *testing.T) {
+	FlattenDepth = 2
+	defer func() { FlattenDepth = 0 }()
+	pa, cancelA := WithCancel(WithValue(Background(), "k", "A"))
+	defer cancelA()
+	pb, cancelB := WithCancel(WithValue(Background(), "k", "B"))
+	defer cancelB()
+	mid, cancelMid := WithCancel(pa)
+	defer cancelMid()
+	leaf := mid
+	for i := range 4 {
+		leaf = WithValue(leaf, i, i)
+	}
+	if _, ok := leaf.(*flatCtx); !ok {
+		t.Fatalf("leaf is %T, want *flatCtx", leaf)
+	}
+	if got := leaf.Value(0); got != 0 {
+		t.Errorf("Value(0) = %v, want 0", got)
+	}
+
+	if !Reparent(mid, pb) {
+		t.Fatal("Reparent = false, want true")
+	}
+	if got := leaf.Value("k"); got != "B" {
+		t.Errorf("Value after Reparent = %v, want B", got)
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/qingyun-007/context
+
+go 1.24
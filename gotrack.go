@@ -0,0 +1,138 @@
+package context
+
+import (
+	"bytes"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Go 起一个协程跑f(ctx)。 协程登记在ctx上。 WaitTracked可以等它结束
+// 和直接go f(ctx)一样。 只是多了登记和一个pprof标签。 关停的时候能知道是谁没退出来
+func Go(ctx Context, f func(Context)) {
+	if ctx == nil {
+		panic("cannot create context from nil parent")
+	}
+	g := &trackedGo{ctx: ctx, id: strconv.FormatUint(goSeq.Add(1), 10), done: make(chan struct{})}
+	goTrack.mu.Lock()
+	goTrack.set[g] = struct{}{}
+	goTrack.mu.Unlock()
+	go func() {
+		defer func() {
+			goTrack.mu.Lock()
+			delete(goTrack.set, g)
+			goTrack.mu.Unlock()
+			close(g.done)
+		}()
+		// 打上标签。 卡住了再从goroutine profile里按标签把它找出来。 平时不用去拿调用栈
+		pprof.SetGoroutineLabels(pprof.WithLabels(Background(), pprof.Labels(goLabel, g.id)))
+		f(ctx)
+	}()
+}
+
+// StuckError WaitTracked等了grace还没退出来的协程
+type StuckError struct {
+	Stacks []string // one per goroutine, from the goroutine profile; includes goroutines the stuck ones started
+}
+
+func (e *StuckError) Error() string {
+	return "context: " + strconv.Itoa(len(e.Stacks)) + " goroutines did not exit:\n\n" +
+		strings.Join(e.Stacks, "\n\n")
+}
+
+// WaitTracked 等用Go登记在ctx以及它下面的ctx上的协程全部退出。 一般是取消了ctx之后调
+// 最多等grace。 到时间还有没退出的。 返回*StuckError。 里面是这些协程现在的调用栈
+// ctx是Background() TODO()的话。 等所有登记过的协程
+func WaitTracked(ctx Context, grace time.Duration) error {
+	goTrack.mu.Lock()
+	var gs []*trackedGo
+	for g := range goTrack.set {
+		if underCtx(ctx, g.ctx) {
+			gs = append(gs, g)
+		}
+	}
+	goTrack.mu.Unlock()
+
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	for i, g := range gs {
+		select {
+		case <-g.done:
+		case <-timer.C:
+			return stuck(gs[i:])
+		}
+	}
+	return nil
+}
+
+type trackedGo struct {
+	ctx  Context
+	id   string // value of the goLabel pprof label
+	done chan struct{}
+}
+
+// goLabel Go打的pprof标签的名字。 值是goSeq发的号
+const goLabel = "context.Go"
+
+var goSeq atomic.Uint64
+
+var goTrack = struct {
+	mu  sync.Mutex
+	set map[*trackedGo]struct{}
+}{set: make(map[*trackedGo]struct{})}
+
+// underCtx c是不是ctx自己或者ctx下面的
+func underCtx(ctx, c Context) bool {
+	switch ctx.(type) {
+	case backgroundCtx, todoCtx, emptyCtx:
+		return true
+	}
+	return isAncestor(ctx, c)
+}
+
+// stuck 从goroutine profile里挑出还没退出的那几个协程
+// 只有真的卡住了才会走到这里。 多花点时间没关系
+func stuck(gs []*trackedGo) error {
+	ids := make(map[string]bool)
+	for _, g := range gs {
+		select {
+		case <-g.done:
+		default:
+			ids[g.id] = true
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	pprof.Lookup("goroutine").WriteTo(&buf, 1)
+	e := &StuckError{}
+	found := make(map[string]bool)
+	for _, rec := range strings.Split(buf.String(), "\n\n") {
+		if id, ok := labelValue(rec); ok && ids[id] {
+			e.Stacks = append(e.Stacks, rec)
+			found[id] = true
+		}
+	}
+	// 标签没找到的: 还没来得及跑起来。 或者f自己把标签换掉了。 也算一个
+	for id := range ids {
+		if !found[id] {
+			e.Stacks = append(e.Stacks, "goroutine ? [context.Go "+id+", stack not found]")
+		}
+	}
+	return e
+}
+
+// labelValue 从profile里一条记录的 # labels: {"context.Go":"17"} 这一行里取出17
+func labelValue(rec string) (string, bool) {
+	_, after, ok := strings.Cut(rec, "\""+goLabel+"\":\"")
+	if !ok {
+		return "", false
+	}
+	id, _, ok := strings.Cut(after, "\"")
+	return id, ok
+}
@@ -0,0 +1,50 @@
+package context
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWaitTracked(t *testing.T) {
+	ctx, cancel := WithCancel(Background())
+	for range 3 {
+		Go(ctx, func(ctx Context) { <-ctx.Done() })
+	}
+	cancel()
+	if err := WaitTracked(ctx, 5*time.Second); err != nil {
+		t.Fatalf("WaitTracked = %v, want nil", err)
+	}
+}
+
+func stuckInTest(release chan struct{}) { <-release }
+
+func TestWaitTrackedStuck(t *testing.T) {
+	ctx, cancel := WithCancel(Background())
+	defer cancel()
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	Go(ctx, func(Context) {
+		close(started)
+		stuckInTest(release)
+	})
+	<-started
+	Go(ctx, func(ctx Context) { <-ctx.Done() })
+
+	// 另一棵树上的协程不算
+	other, cancelOther := WithCancel(Background())
+	defer cancelOther()
+	Go(other, func(ctx Context) { <-ctx.Done() })
+
+	cancel()
+	err := WaitTracked(ctx, 50*time.Millisecond)
+	var se *StuckError
+	if !errors.As(err, &se) {
+		t.Fatalf("WaitTracked = %v, want *StuckError", err)
+	}
+	if len(se.Stacks) != 1 || !strings.Contains(se.Stacks[0], "stuckInTest") {
+		t.Fatalf("Stacks = %q, want one stack through stuckInTest", se.Stacks)
+	}
+}
@@ -0,0 +1,80 @@
+package context
+
+import (
+	"sync"
+	"time"
+)
+
+// WithGrace 两段式取消。 调cancel的时候先关SoftDone(不要再接新活了)。 再过grace才真的取消。 Done()才关
+// parent取消了就不等了。 两个一起关
+// 优雅关停HTTP gRPC要的就是这两个信号。 不用自己再拼两个ctx
+func WithGrace(parent Context, grace time.Duration) (Context, CancelFunc) {
+	if parent == nil {
+		panic("cannot create context from nil parent")
+	}
+	c := &graceCtx{grace: grace, soft: make(chan struct{})}
+	c.cancelCtx.propagateCancel(parent, c)
+	return c, c.softCancel
+}
+
+// SoftDone 往上找最近的WithGrace。 返回它的软取消信号
+// 上面没有WithGrace的话软硬不分。 就是ctx.Done()
+func SoftDone(ctx Context) <-chan struct{} {
+	if c, ok := ctx.Value(&graceKey).(*graceCtx); ok {
+		return c.soft
+	}
+	return ctx.Done()
+}
+
+// &graceKey 是graceCtx返回自己用的key。 和cancelCtxKey一个道理
+var graceKey int
+
+// graceCtx 是对cancelCtx的继承。 多了一个先关的soft
+type graceCtx struct {
+	cancelCtx
+	grace    time.Duration
+	soft     chan struct{}
+	softOnce sync.Once
+	timer    deadlineTimer // Under cancelCtx.mu.
+}
+
+// softCancel 先关soft。 grace之后再真的取消
+func (c *graceCtx) softCancel() {
+	c.softOnce.Do(func() {
+		close(c.soft)
+		c.mu.Lock()
+		if c.Err() == nil {
+			c.timer = afterFunc(c.grace, func() {
+				c.cancel(true, Canceled, nil)
+			})
+		}
+		c.mu.Unlock()
+	})
+}
+
+func (c *graceCtx) Value(key any) any {
+	if key == &graceKey {
+		return c
+	}
+	return c.cancelCtx.Value(key)
+}
+
+func (c *graceCtx) String() string {
+	return contextName(c.cancelCtx.parent()) + ".WithGrace(" + c.grace.String() + ")"
+}
+
+// 真的取消了。 soft还没关的话一起关
+func (c *graceCtx) cancel(removeFromParent bool, err, cause error) bool {
+	c.softOnce.Do(func() { close(c.soft) })
+	canceled := c.cancelCtx.cancel(false, err, cause)
+	if removeFromParent {
+		removeChild(c.cancelCtx.parent(), c)
+	}
+	c.mu.Lock()
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	c.mu.Unlock()
+	return canceled
+}
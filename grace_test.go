@@ -0,0 +1,25 @@
+package context
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSoftDoneThroughFilterValues(t *testing.T) {
+	ctx, cancel := WithGrace(Background(), time.Hour)
+	defer cancel()
+	filtered := FilterValues(ctx, func(any) bool { return false })
+	soft := SoftDone(filtered)
+	if soft == filtered.Done() {
+		t.Fatal("SoftDone through FilterValues fell back to Done")
+	}
+	cancel()
+	select {
+	case <-soft:
+	case <-time.After(5 * time.Second):
+		t.Fatal("soft done not closed after cancel")
+	}
+	if err := filtered.Err(); err != nil {
+		t.Fatalf("Err() = %v before the grace period ended", err)
+	}
+}
@@ -0,0 +1,45 @@
+package context
+
+import (
+	"sync"
+)
+
+// Group 和 errgroup 一个意思。 一组协程。 有一个出错了就把组里的ctx取消掉
+type Group struct {
+	cancel CancelCauseFunc
+
+	wg      sync.WaitGroup
+	errOnce sync.Once
+	err     error
+}
+
+// WithGroup 返回一个Group和它的ctx。 第一个错误就是这个ctx的cause
+func WithGroup(parent Context) (*Group, Context) {
+	ctx, cancel := WithCancelCause(parent)
+	return &Group{cancel: cancel}, ctx
+}
+
+// Go 起一个协程跑f。 只有第一个错误会被记下来
+func (g *Group) Go(f func() error) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if err := f(); err != nil {
+			g.errOnce.Do(func() {
+				g.err = err
+				if g.cancel != nil {
+					g.cancel(err)
+				}
+			})
+		}
+	}()
+}
+
+// Wait 等所有协程跑完。 返回第一个错误。 等完了ctx也就取消了
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	if g.cancel != nil {
+		g.cancel(g.err)
+	}
+	return g.err
+}
@@ -0,0 +1,32 @@
+package context
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGroup(t *testing.T) {
+	g, ctx := WithGroup(Background())
+	x := errors.New("second failed")
+	canceled := make(chan error, 2)
+	wait := func() error {
+		<-ctx.Done()
+		canceled <- ctx.Err()
+		return nil
+	}
+	g.Go(wait)
+	g.Go(func() error { return x })
+	g.Go(wait)
+
+	if err := g.Wait(); err != x {
+		t.Fatalf("Wait = %v, want %v", err, x)
+	}
+	for range 2 {
+		if err := <-canceled; err != Canceled {
+			t.Errorf("other goroutine saw %v, want %v", err, Canceled)
+		}
+	}
+	if got := Cause(ctx); got != x {
+		t.Fatalf("Cause = %v, want %v", got, x)
+	}
+}
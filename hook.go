@@ -0,0 +1,120 @@
+package context
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Hook 给链路追踪 APM这些埋点用的。 不用fork这个包
+// OnNew 新建了一个ctx。 kind是 "WithCancel" "WithDeadline" "WithValue" 这种
+// OnCancel 能取消的ctx第一次被取消。 err和cause就是它的Err()和Cause()
+// OnValueLookup 有人查了一次值。 ctx是给出答案的那个节点: 查到了就是存着这个值的节点。 没查到就是根或者把key藏起来的节点
+// Merge WithParents这种有好几个parent的。 一次查值可能会报好几次
+// 连带取消的孩子是拿着parent的锁调OnCancel的。 所以这几个方法要快。 也不要回过头去取消ctx
+type Hook interface {
+	OnNew(ctx Context, kind string)
+	OnCancel(ctx Context, err, cause error)
+	OnValueLookup(ctx Context, key any, hit bool)
+}
+
+var hooks struct {
+	mu   sync.Mutex                    // serializes RegisterHook and the remove funcs
+	list atomic.Pointer[[]*hookHandle] // copied on write, read without locking
+}
+
+type hookHandle struct{ h Hook }
+
+// RegisterHook 注册一个Hook。 返回的remove把它去掉。 只对之后的事件生效
+func RegisterHook(h Hook) (remove func()) {
+	if h == nil {
+		panic("nil hook")
+	}
+	handle := &hookHandle{h}
+	hooks.mu.Lock()
+	defer hooks.mu.Unlock()
+	var list []*hookHandle
+	if old := hooks.list.Load(); old != nil {
+		list = append(list, *old...)
+	}
+	list = append(list, handle)
+	hooks.list.Store(&list)
+	return func() {
+		hooks.mu.Lock()
+		defer hooks.mu.Unlock()
+		old := hooks.list.Load()
+		if old == nil {
+			return
+		}
+		list := make([]*hookHandle, 0, len(*old))
+		for _, o := range *old {
+			if o != handle {
+				list = append(list, o)
+			}
+		}
+		hooks.list.Store(&list)
+	}
+}
+
+// loadHooks 没有注册过就是nil。 热路径上只多一次原子读
+func loadHooks() []*hookHandle {
+	if p := hooks.list.Load(); p != nil {
+		return *p
+	}
+	return nil
+}
+
+// hooked 新建的ctx先交给hook看一眼再返回
+func hooked(c Context) Context {
+	if list := loadHooks(); len(list) > 0 {
+		kind := kindOf(c)
+		for _, o := range list {
+			o.h.OnNew(c, kind)
+		}
+	}
+	return c
+}
+
+// kindOf 从String()里取出是哪个函数建的。 比如 WithDeadline(...) 只要 WithDeadline
+func kindOf(c Context) string {
+	if _, ok := c.(*nameCtx); ok {
+		return "WithName"
+	}
+	if _, ok := c.(*builtCtx); ok {
+		return "Build"
+	}
+	s := ownPart(contextName(c))
+	if i := strings.IndexByte(s, '('); i >= 0 {
+		s = s[:i]
+	}
+	return s
+}
+
+// hookCancel c第一次被取消之后调。 不能拿着c自己的锁
+func (c *cancelCtx) hookCancel(err, cause error) {
+	list := loadHooks()
+	if len(list) == 0 {
+		return
+	}
+	self, ok := c.self.(Context)
+	if !ok {
+		return
+	}
+	if _, ok := c.self.(*afterFuncCtx); ok {
+		return
+	}
+	for _, o := range list {
+		o.h.OnCancel(self, err, cause)
+	}
+}
+
+// hookLookup 报一次查值。 内部用来找节点的key不报
+func hookLookup(c Context, key any, hit bool) {
+	list := loadHooks()
+	if len(list) == 0 || internalKey(key) {
+		return
+	}
+	for _, o := range list {
+		o.h.OnValueLookup(c, key, hit)
+	}
+}
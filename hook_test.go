@@ -0,0 +1,89 @@
+package context
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// recordHook 把收到的事件按顺序记到一个共享的列表里。 前面带着自己的名字
+type recordHook struct {
+	id     string
+	mu     *sync.Mutex
+	events *[]string
+}
+
+func (h recordHook) add(s string) {
+	h.mu.Lock()
+	*h.events = append(*h.events, h.id+" "+s)
+	h.mu.Unlock()
+}
+
+func (h recordHook) OnNew(ctx Context, kind string) { h.add("new " + kind) }
+
+func (h recordHook) OnCancel(ctx Context, err, cause error) {
+	h.add("cancel " + err.Error() + " " + cause.Error())
+}
+
+func (h recordHook) OnValueLookup(ctx Context, key any, hit bool) {
+	if hit {
+		h.add("hit " + keyString(key) + " at " + contextName(ctx))
+	} else {
+		h.add("miss " + keyString(key) + " at " + contextName(ctx))
+	}
+}
+
+func TestRegisterHook(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	take := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		got := events
+		events = nil
+		return got
+	}
+	remove1 := RegisterHook(recordHook{"h1", &mu, &events})
+	defer remove1()
+	remove2 := RegisterHook(recordHook{"h2", &mu, &events})
+	defer remove2()
+
+	// 按注册的顺序调
+	v := WithValue(Background(), "k", 1)
+	ctx, cancel := WithCancelCause(v)
+	if got, want := take(), []string{"h1 new WithValue", "h2 new WithValue", "h1 new WithCancel", "h2 new WithCancel"}; !slices.Equal(got, want) {
+		t.Errorf("OnNew events = %q, want %q", got, want)
+	}
+
+	// 查到了报存着值的节点。 没查到报根。 找cancelCtx的内部查询不报
+	ctx.Value("k")
+	ctx.Value("nope")
+	if got, want := take(), []string{
+		"h1 hit k at context.Background.WithValue(k, int)", "h2 hit k at context.Background.WithValue(k, int)",
+		"h1 miss nope at context.Background", "h2 miss nope at context.Background",
+	}; !slices.Equal(got, want) {
+		t.Errorf("lookup events = %q, want %q", got, want)
+	}
+
+	cancel(errors.New("boom"))
+	cancel(errors.New("again"))
+	if got, want := take(), []string{"h1 cancel context canceled boom", "h2 cancel context canceled boom"}; !slices.Equal(got, want) {
+		t.Errorf("OnCancel events = %q, want %q", got, want)
+	}
+
+	// 去掉之后就不再调。 重复去掉也没事
+	remove1()
+	remove1()
+	_, cancel2 := WithCancel(Background())
+	cancel2()
+	if got, want := take(), []string{"h2 new WithCancel", "h2 cancel context canceled context canceled"}; !slices.Equal(got, want) {
+		t.Errorf("events after remove = %q, want %q", got, want)
+	}
+	remove2()
+	_, cancel2 = WithCancel(Background())
+	cancel2()
+	if got := take(); len(got) != 0 {
+		t.Errorf("events after removing all hooks = %q, want none", got)
+	}
+}
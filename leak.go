@@ -0,0 +1,33 @@
+package context
+
+import (
+	"runtime"
+)
+
+// OnLeak 不是nil的时候。 之后创建的每个能取消的ctx都会被盯着
+// 要是一直没取消(自己没调cancel parent也没取消)就被GC回收了。 就调OnLeak。 参数是ctx的名字和创建的位置
+// 抓的就是 ctx, _ := WithCancel(...) 这种忘了调cancel的
+// 注意: 挂在活着的cancelCtx下面的孩子。 会被parent的children一直引用着。 parent不取消它就回收不了。 这种抓不到
+// 要抓调用栈。 比较慢。 只在调试的时候打开。 OnLeak在GC的协程里调。 不要在里面干太久
+var OnLeak func(name, stack string)
+
+type leakInfo struct {
+	name  string
+	stack string
+}
+
+// watchLeak 给c挂一个GC清理函数。 c取消的时候会把它撤掉。 调用前c.self要已经设好
+func (c *cancelCtx) watchLeak() {
+	// AfterFunc是内部用的。 不调stop也不算泄漏
+	if _, ok := c.self.(*afterFuncCtx); ok {
+		return
+	}
+	info := leakInfo{name: c.name(), stack: callerStack()}
+	h := runtime.AddCleanup(c, func(info leakInfo) {
+		if f := OnLeak; f != nil {
+			f(info.name, info.stack)
+		}
+	}, info)
+	// 还没挂到parent上。 别人碰不到c。 不用加锁
+	c.leak = &h
+}
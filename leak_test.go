@@ -0,0 +1,56 @@
+package context
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOnLeak(t *testing.T) {
+	leaked := make(chan string, 16)
+	OnLeak = func(name, stack string) {
+		if strings.HasPrefix(name, "leak-test") {
+			leaked <- name + "\n" + stack
+		}
+	}
+	defer func() { OnLeak = nil }()
+
+	// 取消过的不算泄漏
+	func() {
+		_, cancel := WithCancel(WithName(Background(), "leak-test-canceled"))
+		cancel()
+	}()
+	// 忘了调cancel。 也没人引用了
+	func() {
+		WithCancel(WithName(Background(), "leak-test-dropped"))
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	var got string
+	for got == "" && time.Now().Before(deadline) {
+		runtime.GC()
+		select {
+		case got = <-leaked:
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if got == "" {
+		t.Fatal("OnLeak never called for a dropped ctx")
+	}
+	if !strings.HasPrefix(got, "leak-test-dropped") {
+		t.Errorf("OnLeak got %q, want the dropped ctx", got)
+	}
+	if !strings.Contains(got, "TestOnLeak") {
+		t.Errorf("OnLeak stack = %q, want the creating test", got)
+	}
+	// 再多跑几次GC。 取消过的那个也不会报
+	for range 5 {
+		runtime.GC()
+	}
+	select {
+	case got = <-leaked:
+		t.Errorf("OnLeak called for %q", got)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
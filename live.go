@@ -0,0 +1,90 @@
+package context
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// TrackLive 打开之后。 之后创建的能取消的ctx在取消之前都登记在一张表里。 用LiveContexts查
+// 长时间跑的服务上看哪些请求树卡住了用的。 ctxdebug包里有现成的http页面
+// 表里拿着ctx的引用。 忘了取消的ctx会一直留在表里。 OnLeak也就抓不到它了
+var TrackLive bool
+
+// LiveInfo 一个还没取消的ctx的情况
+type LiveInfo struct {
+	Name     string        // String()
+	Parent   string        // parent的String()
+	Age      time.Duration // 建了多久了
+	Deadline time.Time     // 没有截止日期就是零值
+	Stack    string        // 创建的位置。 RecordCreationStack没开就是""
+}
+
+var live struct {
+	mu  sync.Mutex
+	ctx map[*cancelCtx]time.Time // -> when it was created
+}
+
+// trackLive 登记一下。 调用前c.self要已经设好。 还没交出去之前调。 所以tracked不用加锁
+func (c *cancelCtx) trackLive() {
+	// AfterFunc是内部用的。 不算
+	if _, ok := c.self.(*afterFuncCtx); ok {
+		return
+	}
+	c.tracked = true
+	live.mu.Lock()
+	if live.ctx == nil {
+		live.ctx = make(map[*cancelCtx]time.Time)
+	}
+	live.ctx[c] = time.Now()
+	live.mu.Unlock()
+}
+
+// untrackLive 取消了就从表里删掉
+func (c *cancelCtx) untrackLive() {
+	live.mu.Lock()
+	delete(live.ctx, c)
+	live.mu.Unlock()
+}
+
+// LiveContexts 返回表里所有还没取消的ctx。 最老的在最前面
+func LiveContexts() []LiveInfo {
+	type entry struct {
+		c       *cancelCtx
+		created time.Time
+	}
+	// 先在锁里抄一份。 拿名字的时候会去拿ctx自己的锁
+	live.mu.Lock()
+	entries := make([]entry, 0, len(live.ctx))
+	for c, t := range live.ctx {
+		entries = append(entries, entry{c, t})
+	}
+	live.mu.Unlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].created.Before(entries[j].created)
+	})
+	now := time.Now()
+	infos := make([]LiveInfo, 0, len(entries))
+	for _, e := range entries {
+		c := e.c
+		if c.Err() != nil {
+			continue
+		}
+		info := LiveInfo{
+			Name:  c.name(),
+			Age:   now.Sub(e.created),
+			Stack: c.stack,
+		}
+		if self, ok := c.self.(Context); ok {
+			if d, ok := self.Deadline(); ok {
+				info.Deadline = d
+			}
+			if p := parentOf(self); p != nil {
+				info.Parent = contextName(p)
+			}
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
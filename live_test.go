@@ -0,0 +1,63 @@
+package context
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func liveNamed(prefix string) []LiveInfo {
+	var out []LiveInfo
+	for _, info := range LiveContexts() {
+		if strings.HasPrefix(info.Name, prefix) {
+			out = append(out, info)
+		}
+	}
+	return out
+}
+
+func TestLiveContexts(t *testing.T) {
+	// 没打开的时候建的不登记
+	_, cancelOff := WithCancel(WithName(Background(), "live-off"))
+	defer cancelOff()
+
+	TrackLive = true
+	defer func() { TrackLive = false }()
+	req := WithName(Background(), "live-req")
+	ctx, cancel := WithTimeout(req, time.Hour)
+	defer cancel()
+	child, cancelChild := WithCancel(ctx)
+	defer cancelChild()
+	want, _ := ctx.Deadline()
+
+	if got := liveNamed("live-off"); len(got) != 0 {
+		t.Errorf("ctx created with TrackLive off is listed: %+v", got)
+	}
+	got := liveNamed("live-req")
+	if len(got) != 2 {
+		t.Fatalf("LiveContexts = %+v, want 2 entries", got)
+	}
+	// 老的在前面。 名字里带着剩下的时间。 只比前后缀
+	if !strings.HasPrefix(got[0].Name, "live-req.WithDeadline(") || strings.HasSuffix(got[0].Name, ".WithCancel") ||
+		!strings.HasSuffix(got[1].Name, ".WithCancel") {
+		t.Errorf("names = %q, %q, want the WithDeadline first", got[0].Name, got[1].Name)
+	}
+	if got[0].Parent != "live-req" {
+		t.Errorf("Parent = %q, want live-req", got[0].Parent)
+	}
+	if !got[0].Deadline.Equal(want) || !got[1].Deadline.Equal(want) {
+		t.Errorf("Deadline = %v, %v, want %v", got[0].Deadline, got[1].Deadline, want)
+	}
+
+	// 取消了就从表里删掉。 parent取消连带的孩子也删
+	cancel()
+	if got := liveNamed("live-req"); len(got) != 0 {
+		t.Errorf("LiveContexts after cancel = %+v, want none", got)
+	}
+	live.mu.Lock()
+	_, still := live.ctx[child.(*cancelCtx)]
+	live.mu.Unlock()
+	if still {
+		t.Error("canceled child still in the live table")
+	}
+}
@@ -0,0 +1,228 @@
+package context
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Merge 把两个ctx合成一个。 a和b哪个先取消。 合出来的ctx就跟着取消。 Err()和Cause()用先取消的那个的
+// 截止日期取两个里面早的那个。 查值先找a那一串。 找不到再去b那一串找
+// 用在请求的ctx和服务关闭的ctx两边都要听的时候
+// 挂在a上面和WithCancel一样。 b那边是用AfterFunc盯着的。 取消之后两边都会摘干净
+func Merge(a, b Context) (Context, CancelFunc) {
+	if a == nil || b == nil {
+		panic("cannot create context from nil parent")
+	}
+	c := &mergeCtx{b: b}
+	c.cancelCtx.propagateCancel(a, c)
+	// b已经取消了的话。 AfterFunc是另开协程去跑的。 这里先同步看一眼。 返回的时候Err()就已经不是nil了
+	select {
+	case <-b.Done():
+		c.cancel(true, b.Err(), parentCause(b))
+		return c, func() { c.cancel(true, Canceled, nil) }
+	default:
+	}
+	stop := AfterFunc(b, func() {
+		c.cancel(true, b.Err(), parentCause(b))
+	})
+	// AfterFunc可能已经在跑了。 所以stop要在锁里面存。 存的时候已经取消了就自己摘掉
+	c.mu.Lock()
+	c.stopB = stop
+	canceled := c.Err() != nil
+	c.mu.Unlock()
+	if canceled {
+		stop()
+	}
+	return c, func() { c.cancel(true, Canceled, nil) }
+}
+
+// mergeCtx 本身是挂在a下面的cancelCtx。 多记了一个b
+type mergeCtx struct {
+	cancelCtx
+	b     Context
+	stopB func() bool
+}
+
+func (c *mergeCtx) cancel(removeFromParent bool, err, cause error) bool {
+	canceled := c.cancelCtx.cancel(false, err, cause)
+	if removeFromParent {
+		removeChild(c.parent(), c)
+	}
+	c.mu.Lock()
+	stop := c.stopB
+	c.mu.Unlock()
+	if stop != nil {
+		stop()
+	}
+	return canceled
+}
+
+// Deadline 两边早的那个
+func (c *mergeCtx) Deadline() (deadline time.Time, ok bool) {
+	deadline, ok = c.cancelCtx.Deadline()
+	if d, okB := c.b.Deadline(); okB && (!ok || d.Before(deadline)) {
+		deadline, ok = d, true
+	}
+	return
+}
+
+// Value a那一串找不到再找b那一串。 &cancelCtxKey一定是自己
+func (c *mergeCtx) Value(key any) any {
+	if v := c.cancelCtx.Value(key); v != nil || key == &cancelCtxKey {
+		return v
+	}
+	return c.b.Value(key)
+}
+
+func (c *mergeCtx) String() string {
+	return contextName(c.parent()) + ".Merge(" + contextName(c.b) + ")"
+}
+
+// Policy WithParents里面。 几个parent取消到什么程度才取消
+type Policy int
+
+const (
+	// AnyCanceled 任何一个parent取消就取消。 Err()和Cause()用第一个取消的parent的
+	AnyCanceled Policy = iota
+	// AllCanceled 所有parent都取消了才取消。 Err()用最后一个取消的parent的。 Cause()是所有parent的cause用errors.Join合起来
+	AllCanceled
+)
+
+func (p Policy) String() string {
+	switch p {
+	case AnyCanceled:
+		return "AnyCanceled"
+	case AllCanceled:
+		return "AllCanceled"
+	}
+	return "Policy(" + strconv.Itoa(int(p)) + ")"
+}
+
+// WithParents 有好几个parent的ctx。 什么时候取消看policy
+// 截止日期: AnyCanceled取最早的。 AllCanceled要每个parent都有截止日期才有。 取最晚的
+// 查值按parents的顺序一个一个找
+// 每个parent都是用AfterFunc盯着的。 取消之后全部摘掉
+func WithParents(policy Policy, parents ...Context) (Context, CancelFunc) {
+	if len(parents) == 0 {
+		panic("context: WithParents needs at least one parent")
+	}
+	for _, p := range parents {
+		if p == nil {
+			panic("cannot create context from nil parent")
+		}
+	}
+	c := &parentsCtx{
+		policy:  policy,
+		parents: parents,
+		got:     make([]error, len(parents)),
+		left:    len(parents),
+	}
+	// 不挂在任何一个parent的children里面。 Context只是给查值用的
+	c.setup(parents[0], c)
+	// 和Merge一样。 已经取消了的parent先同步记上。 不然要等AfterFunc的协程。 返回的时候Err()可能还是nil
+	for i, p := range parents {
+		select {
+		case <-p.Done():
+			c.parentDone(i, p)
+		default:
+		}
+	}
+	stops := make([]func() bool, 0, len(parents))
+	for i, p := range parents {
+		stops = append(stops, AfterFunc(p, func() { c.parentDone(i, p) }))
+	}
+	c.mu.Lock()
+	c.stops = stops
+	canceled := c.Err() != nil
+	c.mu.Unlock()
+	if canceled {
+		c.stopAll()
+	}
+	return c, func() { c.cancel(true, Canceled, nil) }
+}
+
+type parentsCtx struct {
+	cancelCtx
+	policy  Policy
+	parents []Context
+	got     []error       // causes of the parents canceled so far, nil until counted, under cancelCtx.mu
+	left    int           // parents not canceled yet, under cancelCtx.mu
+	stops   []func() bool // stops the AfterFunc on every parent, under cancelCtx.mu
+}
+
+// parentDone 第i个parent取消了。 同一个parent同步看到一次。 AfterFunc又报一次的话只算一次
+func (c *parentsCtx) parentDone(i int, p Context) {
+	cause := parentCause(p)
+	c.mu.Lock()
+	if c.Err() != nil || c.got[i] != nil {
+		c.mu.Unlock()
+		return
+	}
+	c.got[i] = cause
+	c.left--
+	if c.policy == AllCanceled {
+		if c.left > 0 {
+			c.mu.Unlock()
+			return
+		}
+		cause = errors.Join(c.got...)
+	}
+	c.mu.Unlock()
+	c.cancel(true, p.Err(), cause)
+}
+
+func (c *parentsCtx) cancel(removeFromParent bool, err, cause error) bool {
+	canceled := c.cancelCtx.cancel(false, err, cause)
+	c.stopAll()
+	return canceled
+}
+
+func (c *parentsCtx) stopAll() {
+	c.mu.Lock()
+	stops := c.stops
+	c.stops = nil
+	c.mu.Unlock()
+	for _, stop := range stops {
+		stop()
+	}
+}
+
+func (c *parentsCtx) Deadline() (deadline time.Time, ok bool) {
+	for _, p := range c.parents {
+		d, has := p.Deadline()
+		if !has {
+			if c.policy == AllCanceled {
+				return time.Time{}, false
+			}
+			continue
+		}
+		if !ok ||
+			(c.policy == AnyCanceled && d.Before(deadline)) ||
+			(c.policy == AllCanceled && d.After(deadline)) {
+			deadline, ok = d, true
+		}
+	}
+	return
+}
+
+func (c *parentsCtx) Value(key any) any {
+	if v := c.cancelCtx.Value(key); v != nil || key == &cancelCtxKey {
+		return v
+	}
+	for _, p := range c.parents[1:] {
+		if v := p.Value(key); v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+func (c *parentsCtx) String() string {
+	names := make([]string, len(c.parents))
+	for i, p := range c.parents {
+		names[i] = contextName(p)
+	}
+	return "WithParents(" + c.policy.String() + ", " + strings.Join(names, ", ") + ")"
+}
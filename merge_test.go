@@ -0,0 +1,73 @@
+package context
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMergeCanceledB(t *testing.T) {
+	a, cancelA := WithCancel(Background())
+	defer cancelA()
+	b, cancelB := WithCancelCause(Background())
+	x := errors.New("x")
+	cancelB(x)
+
+	ctx, cancel := Merge(a, b)
+	defer cancel()
+	if err := ctx.Err(); err != Canceled {
+		t.Fatalf("Err() = %v, want %v", err, Canceled)
+	}
+	if got := Cause(ctx); got != x {
+		t.Fatalf("Cause = %v, want %v", got, x)
+	}
+	if n := len(a.(*cancelCtx).childList()); n != 0 {
+		t.Fatalf("a still has %d children", n)
+	}
+}
+
+func TestWithParentsCanceledParent(t *testing.T) {
+	x := errors.New("x")
+	done, cancelDone := WithCancelCause(Background())
+	cancelDone(x)
+
+	ctx, cancel := WithParents(AnyCanceled, done, Background())
+	defer cancel()
+	if err := ctx.Err(); err != Canceled {
+		t.Fatalf("AnyCanceled: Err() = %v, want %v", err, Canceled)
+	}
+	if got := Cause(ctx); got != x {
+		t.Fatalf("AnyCanceled: Cause = %v, want %v", got, x)
+	}
+
+	ctx, cancel = WithParents(AllCanceled, done, done)
+	defer cancel()
+	if err := ctx.Err(); err != Canceled {
+		t.Fatalf("AllCanceled, all done: Err() = %v, want %v", err, Canceled)
+	}
+	if got := Cause(ctx); !errors.Is(got, x) {
+		t.Fatalf("AllCanceled, all done: Cause = %v, want it to match %v", got, x)
+	}
+
+	// 同步记过一次的parent。 AfterFunc再报一次不能再算
+	p1, cancel1 := WithCancel(Background())
+	p2, cancel2 := WithCancel(Background())
+	defer cancel2()
+	ctx, cancel = WithParents(AllCanceled, done, p1, p2)
+	defer cancel()
+	if err := ctx.Err(); err != nil {
+		t.Fatalf("AllCanceled, one done: Err() = %v, want nil", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	cancel1()
+	time.Sleep(10 * time.Millisecond)
+	if err := ctx.Err(); err != nil {
+		t.Fatalf("AllCanceled, two of three done: Err() = %v, want nil", err)
+	}
+	cancel2()
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("AllCanceled: not canceled after every parent was")
+	}
+}
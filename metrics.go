@@ -0,0 +1,90 @@
+package context
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// CauseClass 取消的原因大概是哪一类。 给指标打标签用的。 具体的cause太多了不能直接当标签
+type CauseClass int
+
+const (
+	// CauseCanceled 调了取消函数。 没给cause或者cause就是Canceled
+	CauseCanceled CauseClass = iota
+	// CauseDeadline 到期了
+	CauseDeadline
+	// CauseCustom 取消的时候给了自己的cause
+	CauseCustom
+)
+
+func (k CauseClass) String() string {
+	switch k {
+	case CauseCanceled:
+		return "canceled"
+	case CauseDeadline:
+		return "deadline"
+	}
+	return "custom"
+}
+
+// classify 看cause是哪一类
+func classify(cause error) CauseClass {
+	switch {
+	case errors.Is(cause, DeadlineExceeded):
+		return CauseDeadline
+	case cause == nil || cause == Canceled:
+		return CauseCanceled
+	}
+	return CauseCustom
+}
+
+// MetricsHook 接指标用的。 比如expvar或者Prometheus的计数器
+// 能取消的ctx(WithCancel WithTimeout这些)建的时候调Created。 第一次取消的时候调Canceled。 到期的话调的是Expired
+// name就是ctx的String()。 太长的话自己截一下。 或者用WithName起个短名字
+// 连带取消的孩子是拿着parent的锁调的。 所以这几个方法要快。 也不要回过头去碰ctx
+type MetricsHook interface {
+	Created(name string)
+	Canceled(name string, class CauseClass)
+	Expired(name string)
+}
+
+type metricsHolder struct{ h MetricsHook }
+
+var metrics atomic.Pointer[metricsHolder]
+
+// SetMetricsHook 设置指标的回调。 nil就是关掉。 只对之后的事件生效
+func SetMetricsHook(h MetricsHook) {
+	if h == nil {
+		metrics.Store(nil)
+		return
+	}
+	metrics.Store(&metricsHolder{h})
+}
+
+// metricsCreated c刚建好的时候调。 调用前c.self要已经设好
+func (c *cancelCtx) metricsCreated() {
+	m := metrics.Load()
+	if m == nil {
+		return
+	}
+	if _, ok := c.self.(*afterFuncCtx); ok {
+		return
+	}
+	m.h.Created(c.name())
+}
+
+// metricsCanceled c第一次被取消之后调。 不能拿着c自己的锁
+func (c *cancelCtx) metricsCanceled(err, cause error) {
+	m := metrics.Load()
+	if m == nil {
+		return
+	}
+	if _, ok := c.self.(*afterFuncCtx); ok {
+		return
+	}
+	if err == DeadlineExceeded {
+		m.h.Expired(c.name())
+		return
+	}
+	m.h.Canceled(c.name(), classify(cause))
+}
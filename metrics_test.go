@@ -0,0 +1,105 @@
+package context
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countHook 只数名字以m-开头的。 别的测试建的ctx不算
+type countHook struct {
+	mu       sync.Mutex
+	created  int
+	canceled map[CauseClass]int
+	expired  int
+}
+
+func (h *countHook) Created(name string) {
+	if strings.HasPrefix(name, "m-") {
+		h.mu.Lock()
+		h.created++
+		h.mu.Unlock()
+	}
+}
+
+func (h *countHook) Canceled(name string, class CauseClass) {
+	if strings.HasPrefix(name, "m-") {
+		h.mu.Lock()
+		h.canceled[class]++
+		h.mu.Unlock()
+	}
+}
+
+func (h *countHook) Expired(name string) {
+	if strings.HasPrefix(name, "m-") {
+		h.mu.Lock()
+		h.expired++
+		h.mu.Unlock()
+	}
+}
+
+func (h *countHook) check(t *testing.T, created, canceled, deadline, custom, expired int) {
+	t.Helper()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.created != created {
+		t.Errorf("created = %d, want %d", h.created, created)
+	}
+	for class, want := range map[CauseClass]int{CauseCanceled: canceled, CauseDeadline: deadline, CauseCustom: custom} {
+		if got := h.canceled[class]; got != want {
+			t.Errorf("canceled[%v] = %d, want %d", class, got, want)
+		}
+	}
+	if h.expired != expired {
+		t.Errorf("expired = %d, want %d", h.expired, expired)
+	}
+}
+
+func TestMetricsHook(t *testing.T) {
+	h := &countHook{canceled: make(map[CauseClass]int)}
+	SetMetricsHook(h)
+	defer SetMetricsHook(nil)
+	root := WithName(Background(), "m-root")
+
+	parent, cancelParent := WithCancel(root)
+	_, cancelChild := WithCancel(parent)
+	defer cancelChild()
+	h.check(t, 2, 0, 0, 0, 0)
+	// 连带取消的孩子也算一次。 再调一次取消不重复算
+	cancelParent()
+	cancelParent()
+	h.check(t, 2, 2, 0, 0, 0)
+
+	_, cancelCause := WithCancelCause(root)
+	cancelCause(errors.New("boom"))
+	h.check(t, 3, 2, 0, 1, 0)
+	// 自己给的cause包着DeadlineExceeded也算到期那一类。 但不是Expired
+	_, cancelCause = WithCancelCause(root)
+	cancelCause(fmt.Errorf("upstream: %w", DeadlineExceeded))
+	h.check(t, 4, 2, 1, 1, 0)
+
+	ctx, cancel := WithTimeout(root, time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	h.check(t, 5, 2, 1, 1, 1)
+
+	// AfterFunc内部用的ctx不算
+	stop := AfterFunc(root, func() {})
+	stop()
+	h.check(t, 5, 2, 1, 1, 1)
+
+	// 关掉之后不再调
+	SetMetricsHook(nil)
+	_, cancel = WithCancel(root)
+	cancel()
+	h.check(t, 5, 2, 1, 1, 1)
+
+	for class, want := range map[CauseClass]string{CauseCanceled: "canceled", CauseDeadline: "deadline", CauseCustom: "custom"} {
+		if got := class.String(); got != want {
+			t.Errorf("CauseClass(%d).String() = %q, want %q", class, got, want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package context
+
+import "sync"
+
+// 流水线的几个零件。 每个都开一个协程从上游收、往下游发
+// 上游关了或者ctx结束了。 协程就退出。 把自己的输出关掉。 下游for range就能正常结束
+// ctx结束的时候上游里还没收的就不管了。 上游自己要看ctx退出。 不然它会卡在发送上
+
+// OrDone 原样转发in。 ctx结束了就停
+func OrDone[T any](ctx Context, in <-chan T) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for {
+			v, err := Recv(ctx, in)
+			if err != nil {
+				return
+			}
+			if Send(ctx, out, v) != nil {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// Map 每个值过一遍f再发出去
+func Map[T, U any](ctx Context, in <-chan T, f func(T) U) <-chan U {
+	out := make(chan U)
+	go func() {
+		defer close(out)
+		for {
+			v, err := Recv(ctx, in)
+			if err != nil {
+				return
+			}
+			if Send(ctx, out, f(v)) != nil {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// Filter 只发keep返回true的
+func Filter[T any](ctx Context, in <-chan T, keep func(T) bool) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for {
+			v, err := Recv(ctx, in)
+			if err != nil {
+				return
+			}
+			if !keep(v) {
+				continue
+			}
+			if Send(ctx, out, v) != nil {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// FanIn 几个channel合成一个。 顺序不保证。 全部关了(或者ctx结束了)才关输出
+func FanIn[T any](ctx Context, ins ...<-chan T) <-chan T {
+	out := make(chan T)
+	var wg sync.WaitGroup
+	wg.Add(len(ins))
+	for _, in := range ins {
+		go func() {
+			defer wg.Done()
+			for v := range OrDone(ctx, in) {
+				if Send(ctx, out, v) != nil {
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
@@ -0,0 +1,103 @@
+package context
+
+import (
+	"errors"
+	"runtime"
+	"slices"
+	"testing"
+	"time"
+)
+
+// source 发0到n-1。 看着ctx退出。 发完了关掉
+func source(ctx Context, n int) <-chan int {
+	out := make(chan int)
+	go func() {
+		defer close(out)
+		for i := range n {
+			if Send(ctx, out, i) != nil {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// waitGoroutines 等协程数降回base。 流水线的协程是在输出关掉之后才真正退出的
+func waitGoroutines(t *testing.T, base int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > base {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines still running, want %d", runtime.NumGoroutine(), base)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	base := runtime.NumGoroutine()
+	ctx := Background()
+	even := Filter(ctx, Map(ctx, source(ctx, 10), func(i int) int { return i * 10 }), func(i int) bool { return i%20 == 0 })
+	var got []int
+	for v := range OrDone(ctx, even) {
+		got = append(got, v)
+	}
+	if want := []int{0, 20, 40, 60, 80}; !slices.Equal(got, want) {
+		t.Errorf("pipeline = %v, want %v", got, want)
+	}
+
+	merged := FanIn(ctx, source(ctx, 3), source(ctx, 3), source(ctx, 3))
+	got = got[:0]
+	for v := range merged {
+		got = append(got, v)
+	}
+	slices.Sort(got)
+	if want := []int{0, 0, 0, 1, 1, 1, 2, 2, 2}; !slices.Equal(got, want) {
+		t.Errorf("FanIn = %v, want %v", got, want)
+	}
+	waitGoroutines(t, base)
+}
+
+func TestPipelineStageError(t *testing.T) {
+	base := runtime.NumGoroutine()
+	// 中间一步出错就用cause取消整条流水线。 上游下游都要停
+	bad := errors.New("bad value")
+	ctx, cancel := WithCancelCause(Background())
+	defer cancel(nil)
+	src := source(ctx, 1<<20)
+	mapped := Map(ctx, src, func(i int) int {
+		if i == 5 {
+			cancel(bad)
+		}
+		return i
+	})
+	out := FanIn(ctx, Filter(ctx, mapped, func(int) bool { return true }), source(ctx, 1<<20))
+
+	deadline := time.After(5 * time.Second)
+	for n := 0; ; n++ {
+		select {
+		case _, ok := <-out:
+			if !ok {
+				if err := Cause(ctx); err != bad {
+					t.Errorf("Cause = %v, want %v", err, bad)
+				}
+				waitGoroutines(t, base)
+				return
+			}
+		case <-deadline:
+			t.Fatalf("output not closed after a stage error, %d values received", n)
+		}
+	}
+}
+
+func TestPipelineSlowConsumer(t *testing.T) {
+	base := runtime.NumGoroutine()
+	// 下游不收了。 取消之后卡在发送上的协程也要退出
+	ctx, cancel := WithCancel(Background())
+	out := OrDone(ctx, Map(ctx, source(ctx, 100), func(i int) int { return i }))
+	<-out
+	cancel()
+	waitGoroutines(t, base)
+	for range out {
+	}
+}
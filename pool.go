@@ -0,0 +1,81 @@
+package context
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// 请求一个ctx的服务。 每个请求都要建一个cancelCtx。 QPS高了GC压力能看出来
+// NewRequestContext 和 ReleaseContext 配对用。 取消了的cancelCtx放回池子里。 下一个请求接着用
+
+var ctxPool = sync.Pool{New: func() any { return new(cancelCtx) }}
+
+// NewRequestContext 和WithCancel一样。 只是cancelCtx是从池子里拿的
+// 用完了要调ReleaseContext还回去。 不还也没关系。 就是普通的cancelCtx。 GC照样回收
+func NewRequestContext(parent Context) (Context, CancelFunc) {
+	if parent == nil {
+		panic("cannot create context from nil parent")
+	}
+	c := ctxPool.Get().(*cancelCtx)
+	// parent是cancelCtx(或者永远不会取消)的时候。 挂上去摘下来都是自己能控制的。 才能还回池子
+	// 别的情况(afterFuncer 不认识的ctx)。 parent那边的回调或者协程说不定什么时候还会来碰它
+	_, ok := parentCancelCtx(parent)
+	pooled := ok || parent.Done() == nil
+	c.propagateCancel(parent, c)
+	l := &requestLease{c: c}
+	c.mu.Lock()
+	c.pooled = pooled
+	c.lease = l
+	c.mu.Unlock()
+	return c, l.cancel
+}
+
+// requestLease NewRequestContext返回的CancelFunc背后的东西
+// ReleaseContext之后cancelCtx可能已经给了别的请求。 这时候再调旧的CancelFunc什么都不做。 不会去取消别人
+type requestLease struct {
+	c        *cancelCtx
+	released atomic.Bool
+}
+
+func (l *requestLease) cancel() {
+	if !l.released.Load() {
+		l.c.cancel(true, Canceled, nil)
+	}
+}
+
+// ReleaseContext 取消ctx(还没取消的话)。 然后把它放回池子里
+// 调用的人要保证: ctx以及从它派生出来的所有ctx。 以后谁都不会再用了。 包括还在跑的协程和存起来的引用
+// NewRequestContext给的CancelFunc例外。 还回去以后再调它什么都不做
+// 不是NewRequestContext建的。 或者parent不是cancelCtx的。 只取消。 不放回去
+func ReleaseContext(ctx Context) {
+	c, ok := ctx.(*cancelCtx)
+	if !ok {
+		return
+	}
+	c.cancel(true, Canceled, nil)
+	c.mu.Lock()
+	pooled := c.pooled
+	parent := c.parent()
+	lease := c.lease
+	c.mu.Unlock()
+	if !pooled {
+		return
+	}
+	// 先把旧的CancelFunc废掉。 defer cancel()放在ReleaseContext后面跑也没事
+	if lease != nil {
+		lease.released.Store(true)
+	}
+	// parent取消的时候是先把孩子拿出来。 再拿着自己的锁一个个取消的
+	// 在parent的锁上等一下。 正在取消的那一轮一定跑完了。 不会有人再来取消这个已经放回去的ctx
+	// 打开了ParallelCancel的话。 孩子是放开锁以后取消的。 还要等那些协程做完
+	if p, ok := parent.Value(&cancelCtxKey).(*cancelCtx); ok {
+		p.mu.Lock()
+		fanout := p.fanout
+		p.mu.Unlock()
+		if fanout != nil {
+			fanout.Wait()
+		}
+	}
+	*c = cancelCtx{}
+	ctxPool.Put(c)
+}
@@ -0,0 +1,78 @@
+package context
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReleaseContextThenCancel(t *testing.T) {
+	parent, cancelParent := WithCancel(Background())
+	defer cancelParent()
+
+	ctx, cancel := NewRequestContext(parent)
+	ReleaseContext(ctx)
+	// 还回去以后再调旧的CancelFunc。 不能panic
+	cancel()
+
+	// 池子把同一个cancelCtx给了下一个请求。 旧的CancelFunc不能取消它
+	// sync.Pool不保证一定拿回同一个。 多试几次
+	var next Context
+	var cancelNext CancelFunc
+	for range 100 {
+		next, cancelNext = NewRequestContext(parent)
+		if next == ctx {
+			break
+		}
+		cancelNext()
+		next = nil
+	}
+	if next == nil {
+		t.Skip("pool never handed the released context out again")
+	}
+	defer cancelNext()
+	cancel()
+	if err := next.Err(); err != nil {
+		t.Fatalf("stale cancel canceled the next request: Err() = %v", err)
+	}
+	cancelNext()
+	if err := next.Err(); err != Canceled {
+		t.Fatalf("Err() = %v, want %v", err, Canceled)
+	}
+}
+
+func TestReleaseContextWaitsForParallelCancel(t *testing.T) {
+	ParallelCancel = 2
+	defer func() { ParallelCancel = 0 }()
+	parent, cancelParent := WithCancel(Background())
+	var reqs []Context
+	for range parallelCancelMin {
+		ctx, cancel := NewRequestContext(parent)
+		defer cancel()
+		reqs = append(reqs, ctx)
+	}
+	// 让并行取消卡在其中一个孩子上
+	entered, unblock := make(chan struct{}), make(chan struct{})
+	AfterFuncSync(reqs[len(reqs)-1], func() {
+		close(entered)
+		<-unblock
+	})
+	go cancelParent()
+	<-entered
+
+	released := make(chan struct{})
+	go func() {
+		ReleaseContext(reqs[0])
+		close(released)
+	}()
+	select {
+	case <-released:
+		t.Fatal("ReleaseContext returned while the parallel cancel was still running")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(unblock)
+	select {
+	case <-released:
+	case <-time.After(5 * time.Second):
+		t.Fatal("ReleaseContext never returned")
+	}
+}
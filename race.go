@@ -0,0 +1,145 @@
+package context
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrRaceLost Race里面输了的那些。 它们的ctx是以这个cause取消的
+var ErrRaceLost = errors.New("context: lost the race")
+
+// Race 每个fn一个协程一起跑。 每个拿到自己的子ctx
+// 第一个成功的赢。 返回它的结果。 其他的ctx以ErrRaceLost取消。 不等它们退出。 它们的结果丢掉
+// 全都失败了的话。 返回所有的错误errors.Join起来
+// ctx先结束了返回Cause(ctx)
+func Race[T any](ctx Context, fns ...func(Context) (T, error)) (T, error) {
+	var zero T
+	if len(fns) == 0 {
+		return zero, errors.New("context: Race with no functions")
+	}
+	type result struct {
+		i   int
+		v   T
+		err error
+	}
+	// 带缓冲。 输了的人返回的时候没人收也不会卡住
+	results := make(chan result, len(fns))
+	cancels := make([]CancelCauseFunc, len(fns))
+	for i, fn := range fns {
+		c, cancel := WithCancelCause(ctx)
+		cancels[i] = cancel
+		go func() {
+			v, err := fn(c)
+			results <- result{i, v, err}
+		}()
+	}
+	// winner是赢了的那个。 它的ctx只是用完了。 用Canceled收尾。 -1是没有人赢
+	cancelAll := func(cause error, winner int) {
+		for i, cancel := range cancels {
+			if i == winner {
+				cancel(nil)
+			} else {
+				cancel(cause)
+			}
+		}
+	}
+
+	var errs []error
+	for range fns {
+		select {
+		case r := <-results:
+			if r.err == nil {
+				cancelAll(ErrRaceLost, r.i)
+				return r.v, nil
+			}
+			errs = append(errs, r.err)
+		case <-ctx.Done():
+			cancelAll(Cause(ctx), -1)
+			return zero, Cause(ctx)
+		}
+	}
+	cancelAll(nil, -1)
+	return zero, errors.Join(errs...)
+}
+
+// Parallel 每个fn一个协程一起跑。 都在同一个子ctx下面
+// 有一个出错(或者panic)了就把这个ctx取消。 等全部返回之后返回第一个错误
+// 都成功了按fns的顺序返回结果
+func Parallel[T any](ctx Context, fns ...func(Context) (T, error)) ([]T, error) {
+	out := make([]T, len(fns))
+	s := NewScope(ctx)
+	for i, fn := range fns {
+		s.Spawn(func(c Context) error {
+			v, err := fn(c)
+			out[i] = v
+			return err
+		})
+	}
+	if err := s.Join(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ErrHedgeLost Hedge里面输了的那次尝试。 它的ctx是以这个cause取消的
+var ErrHedgeLost = errors.New("context: lost the hedge")
+
+// Hedge 对冲请求。 先跑一次attempt。 过了delay还没结束的话再跑一次一样的。 每次拿到自己的子ctx
+// 先成功的那次赢。 返回它的结果。 另一次以ErrHedgeLost取消。 不等它退出
+// delay之前第一次就失败了。 直接返回它的错误。 不再补发。 两次都失败了返回两个错误errors.Join起来
+// ctx先结束了返回Cause(ctx)
+func Hedge[T any](ctx Context, delay time.Duration, attempt func(Context) (T, error)) (T, error) {
+	type result struct {
+		i   int
+		v   T
+		err error
+	}
+	results := make(chan result, 2)
+	var cancels []CancelCauseFunc
+	start := func() {
+		c, cancel := WithCancelCause(ctx)
+		i := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			v, err := attempt(c)
+			results <- result{i, v, err}
+		}()
+	}
+	// 和Race一样。 赢了的那次只用Canceled收尾。 -1是没有人赢
+	cancelAll := func(cause error, winner int) {
+		for i, cancel := range cancels {
+			if i == winner {
+				cancel(nil)
+			} else {
+				cancel(cause)
+			}
+		}
+	}
+
+	start()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	hedge := timer.C
+	var errs []error
+	var zero T
+	for {
+		select {
+		case r := <-results:
+			if r.err == nil {
+				cancelAll(ErrHedgeLost, r.i)
+				return r.v, nil
+			}
+			errs = append(errs, r.err)
+			if len(errs) == len(cancels) {
+				cancelAll(nil, -1)
+				return zero, errors.Join(errs...)
+			}
+		case <-hedge:
+			hedge = nil
+			start()
+		case <-ctx.Done():
+			cancelAll(Cause(ctx), -1)
+			return zero, Cause(ctx)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package context
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRace(t *testing.T) {
+	winner := make(chan Context, 1)
+	loser := make(chan Context, 1)
+	exited := make(chan struct{})
+	v, err := Race(Background(),
+		func(ctx Context) (int, error) {
+			defer close(exited)
+			loser <- ctx
+			<-ctx.Done()
+			return 0, ctx.Err()
+		},
+		func(ctx Context) (int, error) {
+			winner <- ctx
+			time.Sleep(5 * time.Millisecond)
+			return 7, nil
+		},
+	)
+	if v != 7 || err != nil {
+		t.Fatalf("Race = %v, %v; want 7, nil", v, err)
+	}
+	<-exited
+	if got := Cause(<-loser); got != ErrRaceLost {
+		t.Errorf("loser Cause = %v, want %v", got, ErrRaceLost)
+	}
+	if got := Cause(<-winner); got != Canceled {
+		t.Errorf("winner Cause = %v, want %v", got, Canceled)
+	}
+}
+
+func TestRaceAllFail(t *testing.T) {
+	e1, e2 := errors.New("e1"), errors.New("e2")
+	_, err := Race(Background(),
+		func(Context) (int, error) { return 0, e1 },
+		func(Context) (int, error) { return 0, e2 },
+	)
+	if !errors.Is(err, e1) || !errors.Is(err, e2) {
+		t.Fatalf("Race = %v, want both errors", err)
+	}
+}
+
+func TestParallel(t *testing.T) {
+	out, err := Parallel(Background(),
+		func(Context) (int, error) { return 1, nil },
+		func(Context) (int, error) { return 2, nil },
+	)
+	if err != nil || len(out) != 2 || out[0] != 1 || out[1] != 2 {
+		t.Fatalf("Parallel = %v, %v; want [1 2], nil", out, err)
+	}
+
+	x := errors.New("x")
+	_, err = Parallel(Background(),
+		func(ctx Context) (int, error) {
+			<-ctx.Done()
+			return 0, nil
+		},
+		func(Context) (int, error) { return 0, x },
+	)
+	if err != x {
+		t.Fatalf("Parallel = %v, want %v", err, x)
+	}
+}
+
+func TestHedge(t *testing.T) {
+	first := make(chan Context, 1)
+	second := make(chan Context, 1)
+	exited := make(chan struct{})
+	var calls atomic.Int32
+	v, err := Hedge(Background(), 5*time.Millisecond, func(ctx Context) (int, error) {
+		if calls.Add(1) == 1 {
+			defer close(exited)
+			first <- ctx
+			<-ctx.Done()
+			return 0, ctx.Err()
+		}
+		second <- ctx
+		return 2, nil
+	})
+	if v != 2 || err != nil {
+		t.Fatalf("Hedge = %v, %v; want 2, nil", v, err)
+	}
+	<-exited
+	if got := Cause(<-first); got != ErrHedgeLost {
+		t.Errorf("loser Cause = %v, want %v", got, ErrHedgeLost)
+	}
+	if got := Cause(<-second); got != Canceled {
+		t.Errorf("winner Cause = %v, want %v", got, Canceled)
+	}
+}
+
+func TestHedgeFastAttempt(t *testing.T) {
+	calls := 0
+	v, err := Hedge(Background(), time.Hour, func(Context) (int, error) {
+		calls++
+		return 1, nil
+	})
+	if v != 1 || err != nil || calls != 1 {
+		t.Fatalf("Hedge = %v, %v after %d calls; want 1, nil after 1 call", v, err, calls)
+	}
+
+	x := errors.New("x")
+	if _, err := Hedge(Background(), time.Hour, func(Context) (int, error) { return 0, x }); !errors.Is(err, x) {
+		t.Fatalf("Hedge = %v, want %v", err, x)
+	}
+}
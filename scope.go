@@ -0,0 +1,56 @@
+package context
+
+import "runtime/debug"
+
+// Scope 结构化并发。 Spawn出去的协程都挂在Scope的ctx下面。 Join等它们全部结束
+// 底下就是一个Group。 多出来的是: f拿到的是Scope的ctx。 panic也算出错
+// 用法: s := NewScope(ctx); s.Spawn(f); err := s.Join()
+type Scope struct {
+	g   *Group
+	ctx Context
+}
+
+// PanicError Spawn出去的f panic了。 Join返回的就是它
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return "context: scope goroutine panicked: " + stringify(e.Value)
+}
+
+// Unwrap panic的值是error的话。 errors.Is errors.As能看到它
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// NewScope 建一个挂在parent下面的Scope
+func NewScope(parent Context) *Scope {
+	g, ctx := WithGroup(parent)
+	return &Scope{g: g, ctx: ctx}
+}
+
+// Context Scope自己的ctx。 第一个错误就是它的cause
+func (s *Scope) Context() Context {
+	return s.ctx
+}
+
+// Spawn 起一个协程跑f。 f返回错误或者panic了。 Scope的ctx就以这个错误取消。 只有第一个会被记下来
+// Join之后不要再Spawn
+func (s *Scope) Spawn(f func(ctx Context) error) {
+	s.g.Go(func() (err error) {
+		defer func() {
+			if v := recover(); v != nil {
+				err = &PanicError{Value: v, Stack: debug.Stack()}
+			}
+		}()
+		return f(s.ctx)
+	})
+}
+
+// Join 等所有协程结束。 返回第一个错误(panic的话是*PanicError)。 返回之前把Scope的ctx取消掉
+func (s *Scope) Join() error {
+	return s.g.Wait()
+}
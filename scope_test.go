@@ -0,0 +1,39 @@
+package context
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestScope(t *testing.T) {
+	s := NewScope(Background())
+	x := errors.New("x")
+	s.Spawn(func(ctx Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	s.Spawn(func(Context) error { return x })
+	if err := s.Join(); err != x {
+		t.Fatalf("Join = %v, want %v", err, x)
+	}
+	if got := Cause(s.Context()); got != x {
+		t.Fatalf("Cause = %v, want %v", got, x)
+	}
+}
+
+func TestScopePanic(t *testing.T) {
+	s := NewScope(Background())
+	x := errors.New("boom")
+	s.Spawn(func(Context) error { panic(x) })
+	err := s.Join()
+	var pe *PanicError
+	if !errors.As(err, &pe) {
+		t.Fatalf("Join = %v, want *PanicError", err)
+	}
+	if !errors.Is(err, x) || len(pe.Stack) == 0 {
+		t.Fatalf("PanicError = %v with %d bytes of stack", pe, len(pe.Stack))
+	}
+	if s.Context().Err() == nil {
+		t.Fatal("Scope ctx not canceled after Join")
+	}
+}
@@ -0,0 +1,151 @@
+package context
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Stage 关停走到哪一步了
+type Stage int
+
+const (
+	StageDrain Stage = iota // 不再接新活。 手上的接着做
+	StageStop               // 手上的活也停下来
+	StageForce              // 还没停的不管了。 直接退出
+)
+
+const stageNone Stage = -1
+
+func (s Stage) String() string {
+	switch s {
+	case StageDrain:
+		return "drain"
+	case StageStop:
+		return "stop"
+	case StageForce:
+		return "force"
+	}
+	return "none"
+}
+
+// ErrStageTimeout 上一步超时了。 自动走到下一步
+var ErrStageTimeout = errors.New("context: shutdown stage timed out")
+
+// StageError 关停的每一步的ctx取消的时候的cause
+// Reason是谁推的: 信号是*SignalError。 超时是ErrStageTimeout。 Trigger是nil
+type StageError struct {
+	Stage  Stage
+	Reason error
+}
+
+func (e *StageError) Error() string {
+	if e.Reason == nil {
+		return "shutdown " + e.Stage.String() + ": triggered"
+	}
+	return "shutdown " + e.Stage.String() + ": " + e.Reason.Error()
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Reason
+}
+
+// Shutdown 分步关停。 drain -> stop -> force 三个ctx。 走到哪一步就取消哪一步的ctx
+// 后一步的ctx是前一步的parent。 所以走到stop的时候drain一定也取消了
+// 每来一次SIGTERM或者SIGINT(或者调一次Trigger)往前走一步。 设了超时的话。 这一步超时了自动走下一步
+// 信号被这里接管了。 进程不会因为信号自己退出。 走到force之后要自己退出
+type Shutdown struct {
+	ctxs    [3]Context
+	cancels [3]CancelCauseFunc
+
+	mu       sync.Mutex
+	stage    Stage            // Under mu.
+	timeouts [3]time.Duration // Under mu.
+	timer    deadlineTimer    // Under mu.
+}
+
+// NewShutdown 建一个挂在parent下面的Shutdown。 马上开始接管SIGTERM和SIGINT
+// parent取消了三步一起取消。 用完了要调Close。 不然信号会一直被吞掉
+func NewShutdown(parent Context) *Shutdown {
+	s := &Shutdown{stage: stageNone}
+	p := parent
+	for st := StageForce; st >= StageDrain; st-- {
+		s.ctxs[st], s.cancels[st] = WithCancelCause(p)
+		p = s.ctxs[st]
+	}
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGTERM, syscall.SIGINT)
+	force := s.ctxs[StageForce]
+	go func() {
+		defer signal.Stop(ch)
+		for {
+			select {
+			case sig := <-ch:
+				s.step(stageNone, &SignalError{sig})
+			case <-force.Done():
+				return
+			}
+		}
+	}()
+	return s
+}
+
+// Context 这一步的ctx。 走到这一步的时候取消
+func (s *Shutdown) Context(stage Stage) Context {
+	return s.ctxs[stage]
+}
+
+// SetTimeout 走到stage之后最多等d。 还没往下走就自动走下一步。 0是一直等
+// force是最后一步。 给它设超时没有用
+func (s *Shutdown) SetTimeout(stage Stage, d time.Duration) {
+	s.mu.Lock()
+	s.timeouts[stage] = d
+	s.mu.Unlock()
+}
+
+// Trigger 往前走一步。 已经是force了就什么都不做
+func (s *Shutdown) Trigger() {
+	s.step(stageNone, nil)
+}
+
+// Stage 现在走到哪一步了。 还没开始是-1
+func (s *Shutdown) Stage() Stage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stage
+}
+
+// Close 三步的ctx全部取消。 不再接管信号
+func (s *Shutdown) Close() {
+	s.mu.Lock()
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	s.mu.Unlock()
+	s.cancels[StageForce](nil)
+}
+
+// step 往前走一步。 from不是stageNone的话。 只有现在还停在from才走。 超时用的。 免得和信号Trigger重复走
+// 取消是在锁里做的。 这样一步一步的cause不会乱。 所以不要在AfterFuncSync的回调里调Trigger
+func (s *Shutdown) step(from Stage, reason error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if (from != stageNone && s.stage != from) || s.stage == StageForce {
+		return
+	}
+	s.stage++
+	cur := s.stage
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	if d := s.timeouts[cur]; d > 0 && cur < StageForce {
+		s.timer = afterFunc(d, func() { s.step(cur, ErrStageTimeout) })
+	}
+	s.cancels[cur](&StageError{cur, reason})
+}
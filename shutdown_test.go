@@ -0,0 +1,116 @@
+package context
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// stageCause 取出这一步的StageError。 没取消或者cause不对就是nil
+func stageCause(s *Shutdown, stage Stage) *StageError {
+	var se *StageError
+	if errors.As(Cause(s.Context(stage)), &se) {
+		return se
+	}
+	return nil
+}
+
+func TestShutdownStages(t *testing.T) {
+	s := NewShutdown(Background())
+	defer s.Close()
+	if got := s.Stage(); got != stageNone {
+		t.Fatalf("Stage() before Trigger = %v, want none", got)
+	}
+	for _, st := range []Stage{StageDrain, StageStop, StageForce} {
+		if s.Context(st).Err() != nil {
+			t.Fatalf("%v ctx done before Trigger", st)
+		}
+	}
+
+	// 一次走一步。 前面的步骤都取消了。 后面的还没有
+	for cur := StageDrain; cur <= StageForce; cur++ {
+		s.Trigger()
+		if got := s.Stage(); got != cur {
+			t.Fatalf("Stage() = %v, want %v", got, cur)
+		}
+		for st := StageDrain; st <= StageForce; st++ {
+			if done := s.Context(st).Err() != nil; done != (st <= cur) {
+				t.Errorf("at %v: %v ctx done = %v, want %v", cur, st, done, st <= cur)
+			}
+		}
+		// 每一步的cause是走到它的那一次。 后面的步骤不会改前面的cause
+		for st := StageDrain; st <= cur; st++ {
+			if se := stageCause(s, st); se == nil || se.Stage != st || se.Reason != nil {
+				t.Errorf("at %v: Cause(%v) = %v, want a triggered StageError", cur, st, Cause(s.Context(st)))
+			}
+		}
+	}
+	// force之后再Trigger什么都不做
+	s.Trigger()
+	if got := s.Stage(); got != StageForce {
+		t.Errorf("Stage() after an extra Trigger = %v, want force", got)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	s := NewShutdown(Background())
+	defer s.Close()
+	s.SetTimeout(StageDrain, 10*time.Millisecond)
+	s.SetTimeout(StageStop, 10*time.Millisecond)
+	s.Trigger()
+	select {
+	case <-s.Context(StageForce).Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("stage timeouts did not escalate to force, Stage() = %v", s.Stage())
+	}
+	if se := stageCause(s, StageDrain); se == nil || se.Reason != nil {
+		t.Errorf("Cause(drain) = %v, want triggered", Cause(s.Context(StageDrain)))
+	}
+	for _, st := range []Stage{StageStop, StageForce} {
+		if se := stageCause(s, st); se == nil || se.Stage != st || !errors.Is(se, ErrStageTimeout) {
+			t.Errorf("Cause(%v) = %v, want a timed out StageError", st, Cause(s.Context(st)))
+		}
+	}
+}
+
+func TestShutdownTriggerBeforeTimeout(t *testing.T) {
+	s := NewShutdown(Background())
+	defer s.Close()
+	s.SetTimeout(StageDrain, 20*time.Millisecond)
+	s.Trigger()
+	// 超时之前自己走到stop了。 drain的超时不能再推一步
+	s.Trigger()
+	time.Sleep(60 * time.Millisecond)
+	if got := s.Stage(); got != StageStop {
+		t.Fatalf("Stage() = %v, want stop", got)
+	}
+	if se := stageCause(s, StageStop); se == nil || se.Reason != nil {
+		t.Errorf("Cause(stop) = %v, want triggered", Cause(s.Context(StageStop)))
+	}
+	if s.Context(StageForce).Err() != nil {
+		t.Error("force ctx done without a trigger or timeout")
+	}
+}
+
+func TestShutdownParentAndClose(t *testing.T) {
+	parent, cancel := WithCancel(Background())
+	s := NewShutdown(parent)
+	defer s.Close()
+	cancel()
+	for _, st := range []Stage{StageDrain, StageStop, StageForce} {
+		if err := s.Context(st).Err(); err != Canceled {
+			t.Errorf("after parent cancel: %v Err() = %v, want %v", st, err, Canceled)
+		}
+	}
+
+	s = NewShutdown(Background())
+	s.Close()
+	for _, st := range []Stage{StageDrain, StageStop, StageForce} {
+		if s.Context(st).Err() == nil {
+			t.Errorf("after Close: %v ctx not done", st)
+		}
+	}
+	if got := s.Stage(); got != stageNone {
+		t.Errorf("Stage() after Close = %v, want none", got)
+	}
+}
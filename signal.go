@@ -0,0 +1,38 @@
+package context
+
+import (
+	"os"
+	"os/signal"
+)
+
+// SignalError 是WithSignals收到信号取消的时候的cause。 Signal就是收到的那个信号
+type SignalError struct {
+	Signal os.Signal
+}
+
+func (e *SignalError) Error() string {
+	return "received signal " + e.Signal.String()
+}
+
+// WithSignals 收到sigs里的任何一个信号就取消。 Err()是Canceled。 Cause()是*SignalError
+// sigs一个都不给的话就是所有信号。 和signal.Notify一样
+// stop会取消ctx并且不再接管这些信号。 一定要调。 不然信号会一直被这里吞掉
+// 和标准库的signal.NotifyContext一样。 取消之后stop之前。 再来的信号还是被吞掉
+func WithSignals(parent Context, sigs ...os.Signal) (ctx Context, stop CancelFunc) {
+	c := withCancel(parent)
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	if c.Err() == nil {
+		go func() {
+			select {
+			case s := <-ch:
+				c.cancel(true, Canceled, &SignalError{s})
+			case <-c.Done():
+			}
+		}()
+	}
+	return c, func() {
+		c.cancel(true, Canceled, nil)
+		signal.Stop(ch)
+	}
+}
@@ -0,0 +1,118 @@
+package context
+
+import (
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RecordCreationStack 打开之后。 每个能取消的ctx(WithCancel WithTimeout这些)创建的时候都记下是在哪里建的
+// 用CreationStack查。 DumpTree里也会带上。 找ctx泄漏的时候最想知道的就是这个
+// 要抓调用栈。 比较慢。 只在调试的时候打开
+var RecordCreationStack bool
+
+// stackDepth 最多记几层调用栈
+const stackDepth = 8
+
+// WithStack 不管RecordCreationStack开没开。 都在这里记一下调用栈。 其他的全部交给parent
+// 只想盯某几个ctx的时候用
+func WithStack(parent Context) Context {
+	if parent == nil {
+		panic("cannot create context from nil parent")
+	}
+	return hooked(&stackCtx{parent, callerStack()})
+}
+
+type stackCtx struct {
+	Context
+	stack string
+}
+
+func (c *stackCtx) String() string {
+	return contextName(c.Context) + ".WithStack"
+}
+
+// CreationStack 往上找最近的一个记过调用栈的节点。 返回它的调用栈。 一行一层。 最里面的在最前面
+// 没有记过的话返回""
+func CreationStack(ctx Context) string {
+	for c := ctx; c != nil; c = parentOf(c) {
+		if s := ownStack(c); s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// ownStack c这个节点自己记的调用栈。 不往上找
+func ownStack(c Context) string {
+	if s, ok := c.(*stackCtx); ok {
+		return s.stack
+	}
+	if cc, ok := c.Value(&cancelCtxKey).(*cancelCtx); ok && cc.self != nil && any(cc.self) == any(c) {
+		return cc.stack
+	}
+	return ""
+}
+
+// pkgPath 这个包自己的路径。 抓调用栈的时候跳过包里面的函数
+var pkgPath = reflect.TypeOf(cancelCtx{}).PkgPath()
+
+// callerStack 调用这个包的那一层开始往外的调用栈。 每行是 函数名 文件:行号
+func callerStack() string {
+	var pcs [stackDepth + 8]uintptr
+	n := runtime.Callers(2, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	var b strings.Builder
+	lines := 0
+	for lines < stackDepth {
+		f, more := frames.Next()
+		// 包里面的函数跳过。 只要外面调进来的位置。 包的测试除外
+		if strings.HasPrefix(f.Function, pkgPath+".") && !strings.HasSuffix(f.File, "_test.go") {
+			if !more {
+				break
+			}
+			continue
+		}
+		if lines > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString(f.Function + " " + f.File + ":" + strconv.Itoa(f.Line))
+		lines++
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
+
+// RecordCancelCaller 打开之后。 ctx被取消的时候记下是谁调的取消。 什么时候取消的。 用CancelInfo查
+// 连带取消的孩子记的也是最开始调取消的那个位置
+var RecordCancelCaller bool
+
+// CancelInfo 返回是谁把ctx取消的(函数名 文件:行号)和取消的时间
+// 没取消。 或者取消的时候RecordCancelCaller没开。 ok是false
+// 到期取消的话是定时器的协程在取消。 外面没有调用的位置。 caller是""
+func CancelInfo(ctx Context) (caller string, at time.Time, ok bool) {
+	c, ok := ctx.Value(&cancelCtxKey).(*cancelCtx)
+	if !ok {
+		return "", time.Time{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.at.IsZero() {
+		return "", time.Time{}, false
+	}
+	return c.caller, c.at, true
+}
+
+// cancelCaller 调用栈里第一个不是这个包。 也不是runtime的位置
+func cancelCaller() string {
+	for _, line := range strings.Split(callerStack(), "\n") {
+		if line != "" && !strings.HasPrefix(line, "runtime.") {
+			return line
+		}
+	}
+	return ""
+}
@@ -0,0 +1,99 @@
+package context
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithStack(t *testing.T) {
+	ctx := WithStack(Background())
+	if s := CreationStack(ctx); !strings.Contains(s, "TestWithStack") {
+		t.Errorf("CreationStack() = %q, want it to include the caller TestWithStack", s)
+	}
+	// 往下派生的也能找到
+	child, cancel := WithCancel(WithValue(ctx, "k", 1))
+	defer cancel()
+	if s := CreationStack(child); !strings.Contains(s, "TestWithStack") {
+		t.Errorf("CreationStack(child) = %q, want the stack recorded by WithStack", s)
+	}
+	// 没记过就是空的
+	plain, cancelPlain := WithCancel(Background())
+	defer cancelPlain()
+	if s := CreationStack(plain); s != "" {
+		t.Errorf("CreationStack() without recording = %q, want empty", s)
+	}
+}
+
+func TestRecordCreationStack(t *testing.T) {
+	RecordCreationStack = true
+	defer func() { RecordCreationStack = false }()
+	ctx, cancel := newTimeoutForStack()
+	defer cancel()
+	s := CreationStack(ctx)
+	// 记的是调WithTimeout的那一层。 不是包里面的
+	if !strings.Contains(s, "newTimeoutForStack") {
+		t.Errorf("CreationStack() = %q, want it to include newTimeoutForStack", s)
+	}
+	if strings.Contains(s, "propagateCancel") {
+		t.Errorf("CreationStack() = %q, want the package internals trimmed", s)
+	}
+}
+
+func newTimeoutForStack() (Context, CancelFunc) {
+	return WithTimeout(Background(), time.Hour)
+}
+
+func TestCancelInfo(t *testing.T) {
+	for _, tt := range []struct {
+		caller, path bool
+	}{
+		{false, false},
+		{true, false},
+		{false, true},
+		{true, true},
+	} {
+		RecordCancelCaller, RecordCancelPath = tt.caller, tt.path
+		parent, cancelParent := WithCancel(Background())
+		child, cancelChild := WithCancel(parent)
+		if _, _, ok := CancelInfo(child); ok {
+			t.Errorf("%+v: CancelInfo before cancel ok = true, want false", tt)
+		}
+		before := time.Now()
+		cancelFromHelper(cancelParent)
+		after := time.Now()
+		cancelChild()
+
+		caller, at, ok := CancelInfo(child)
+		if ok != tt.caller {
+			t.Errorf("%+v: CancelInfo ok = %v, want %v", tt, ok, tt.caller)
+		}
+		// 连带取消的孩子记的也是最开始调取消的位置
+		if tt.caller {
+			if !strings.Contains(caller, "cancelFromHelper") {
+				t.Errorf("%+v: caller = %q, want cancelFromHelper", tt, caller)
+			}
+			if at.Before(before) || at.After(after) {
+				t.Errorf("%+v: at = %v, want between %v and %v", tt, at, before, after)
+			}
+		}
+		if path := CancelPath(child); (len(path) == 2) != tt.path {
+			t.Errorf("%+v: CancelPath = %q", tt, path)
+		}
+	}
+	RecordCancelCaller, RecordCancelPath = false, false
+
+	// 到期的是定时器取消的。 没有调用的位置
+	RecordCancelCaller = true
+	defer func() { RecordCancelCaller = false }()
+	ctx, cancel := WithTimeout(Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	if caller, _, ok := CancelInfo(ctx); !ok || caller != "" {
+		t.Errorf("expired ctx: CancelInfo = %q, %v, want \"\", true", caller, ok)
+	}
+}
+
+func cancelFromHelper(cancel CancelFunc) {
+	cancel()
+}
@@ -0,0 +1,399 @@
+package context
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 自己封装了一个exceed错误
+var DeadlineExceeded error = deadlineExceededError{}
+
+type deadlineExceededError struct{}
+
+func (deadlineExceededError) Error() string {
+	if f := DeadlineMessage; f != nil {
+		return f()
+	}
+	return "context deadline exceeded"
+}
+func (deadlineExceededError) Timeout() bool   { return true }
+func (deadlineExceededError) Temporary() bool { return true }
+
+// CanceledByDeadline ctx是不是因为到期才结束的
+// parent到期连带取消的孩子也算。 取消的时候parent的err会原样传给孩子。 所以看Err()就够了
+func CanceledByDeadline(ctx Context) bool {
+	return errors.Is(ctx.Err(), DeadlineExceeded)
+}
+
+// 5.WithDeadLine。返回一个 context 以及 cancel。如果到时间了。ch会自动接到信号
+func WithDeadline(parent Context, d time.Time) (Context, CancelFunc) {
+	return WithDeadlineCause(parent, d, nil)
+}
+
+// 携带截止日期的cancelcontext
+func WithDeadlineCause(parent Context, d time.Time, cause error) (Context, CancelFunc) {
+	if parent == nil {
+		panic("cannot create context from nil parent")
+	}
+
+	// parent context 是否存在截止日期。如果parent的截止日期在 子context 之前或者一样。就没有必要了
+	// 一样的时候parent到期会把子context一起取消。 Deadline()从parent拿到的也是同一个时间
+	if cur, ok := parent.Deadline(); ok && !cur.After(d) {
+		// The current deadline is already sooner than or equal to the new one.
+		return WithCancel(parent)
+	}
+
+	c := &timerCtx{
+		deadline: d,
+	}
+
+	// 将子context 融进parent context
+	c.cancelCtx.propagateCancel(parent, c)
+
+	// 检查到截止日期还有多久
+	dur := time.Until(d)
+	// 如果已经到期了。就直接取消了
+	if dur <= 0 {
+		c.cancel(true, DeadlineExceeded, cause) // deadline has already passed
+		return c, func() { c.cancel(false, Canceled, nil) }
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// 如果timeCtx没有问题的话。时间到期之后。执行取消函数
+	if c.Err() == nil {
+		// afterFunc会在后台计时(开了时间轮就挂在时间轮上)。到时了之后自动取消
+		c.timer = afterFunc(dur, func() {
+			c.cancel(true, DeadlineExceeded, cause)
+		})
+	}
+	// 到期和手动取消谁先谁赢。 err和cause是在同一把锁里一起写的
+	// 后来的那个看到err已经有了就直接返回。 所以不会出现err是到期 cause却是Canceled的情况
+	return c, func() { c.cancel(true, Canceled, nil) }
+}
+
+// timeCtx是对 cancelCtx的继承
+type timerCtx struct {
+	cancelCtx
+	timer deadlineTimer // Under cancelCtx.mu, a *time.Timer or a *wheelTimer.
+
+	deadline time.Time
+	extended atomic.Pointer[time.Time] // deadline moved by TryExtendDeadline, written under cancelCtx.mu
+}
+
+// 被TryExtendDeadline挪过的话用挪过的
+// 不加锁。 String()会调到这里。 取消的时候拿着锁也会去拿名字
+func (c *timerCtx) Deadline() (deadline time.Time, ok bool) {
+	if d := c.extended.Load(); d != nil {
+		return *d, true
+	}
+	return c.deadline, true
+}
+
+func (c *timerCtx) String() string {
+	d, _ := c.Deadline()
+	return contextName(c.cancelCtx.parent()) + ".WithDeadline(" +
+		d.String() + " [" +
+		time.Until(d).String() + "])"
+}
+
+// TryExtendDeadline 把ctx的截止日期往后挪到d。 定时器跟着重新计时
+// d不能超过parent的截止日期。 超过了就挪到parent的截止日期为止
+// 只对WithDeadline WithTimeout建出来的ctx有用。 挪不动(没往后挪 已经取消了 定时器已经响了)返回false
+// 给跑得久的任务续命用。 每报一次进度续一次。 不用把整棵树拆了重建
+func TryExtendDeadline(ctx Context, d time.Time) bool {
+	cc, ok := ctx.Value(&cancelCtxKey).(*cancelCtx)
+	if !ok {
+		return false
+	}
+	c, ok := cc.self.(*timerCtx)
+	if !ok {
+		return false
+	}
+	return c.moveDeadline(d, true)
+}
+
+// moveDeadline 把截止日期挪到d。 定时器跟着重新计时。 d超过parent的截止日期就挪到parent的为止
+// onlyLater为true的时候不许往前挪。 挪不动返回false
+func (c *timerCtx) moveDeadline(d time.Time, onlyLater bool) bool {
+	if cur, ok := c.cancelCtx.parent().Deadline(); ok && cur.Before(d) {
+		d = cur
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Err() != nil || c.timer == nil {
+		return false
+	}
+	if cur, _ := c.Deadline(); onlyLater && !d.After(cur) {
+		return false
+	}
+	// Stop返回false说明定时器已经响了。 取消马上就要来了。 不能再续
+	if !c.timer.Stop() {
+		return false
+	}
+	c.extended.Store(&d)
+	c.timer.Reset(time.Until(d))
+	return true
+}
+
+// ReusableTimer 一个连接一个。 读循环每收一条消息Reset一次。 不用每次都WithTimeout再cancel
+// 上一次的ctx还活着的话。 Reset直接改它的截止日期。 返回的还是同一个ctx。 不分配
+// 已经到期了(或者parent的截止日期更早。 建出来的根本不是timerCtx)才建一个新的。 到期了的ctx是没法复活的
+// 一个ReusableTimer同时只能给一个循环用。 上一次Reset返回的ctx在下一次Reset之后不要再用了
+type ReusableTimer struct {
+	parent Context
+
+	mu     sync.Mutex
+	ctx    Context    // Under mu.
+	cancel CancelFunc // Under mu.
+}
+
+// NewReusableTimer 建一个挂在parent下面的ReusableTimer。 第一次Reset的时候才真的建ctx
+func NewReusableTimer(parent Context) *ReusableTimer {
+	if parent == nil {
+		panic("cannot create context from nil parent")
+	}
+	return &ReusableTimer{parent: parent}
+}
+
+// Reset 从现在开始重新计时d。 返回这一轮用的ctx
+func (t *ReusableTimer) Reset(d time.Duration) Context {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if c, ok := t.ctx.(*timerCtx); ok && c.moveDeadline(time.Now().Add(d), false) {
+		return c
+	}
+	if t.cancel != nil {
+		t.cancel()
+	}
+	t.ctx, t.cancel = WithTimeout(t.parent, d)
+	return t.ctx
+}
+
+// Stop 把当前的ctx取消掉。 连接关了的时候调。 之后还可以再Reset
+func (t *ReusableTimer) Stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.cancel != nil {
+		t.cancel()
+		t.ctx, t.cancel = nil, nil
+	}
+}
+
+func (c *timerCtx) cancel(removeFromParent bool, err, cause error) bool {
+	// 调用从cancelcontext继承的取消
+	canceled := c.cancelCtx.cancel(false, err, cause)
+
+	// 父子分离
+	if removeFromParent {
+		// Remove this timerCtx from its parent cancelCtx's children.
+		removeChild(c.cancelCtx.parent(), c)
+	}
+
+	c.mu.Lock()
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	c.mu.Unlock()
+	return canceled
+}
+
+// withtimeout 就是将现在的时间 加上 超时的时间。 变成了截止日期
+func WithTimeout(parent Context, timeout time.Duration) (Context, CancelFunc) {
+	return WithDeadline(parent, time.Now().Add(timeout))
+}
+
+func WithTimeoutCause(parent Context, timeout time.Duration, cause error) (Context, CancelFunc) {
+	return WithDeadlineCause(parent, time.Now().Add(timeout), cause)
+}
+
+// WithIdleTimeout 闲置超时。 idle这么久没有调touch。 ctx就以DeadlineExceeded取消
+// 每调一次touch。 截止日期就往后推到 now+idle
+func WithIdleTimeout(parent Context, idle time.Duration) (ctx Context, touch func(), cancel CancelFunc) {
+	if parent == nil {
+		panic("cannot create context from nil parent")
+	}
+	c := &idleCtx{idle: idle}
+	c.deadline = time.Now().Add(idle)
+	c.cancelCtx.propagateCancel(parent, c)
+	c.mu.Lock()
+	if c.Err() == nil {
+		c.timer = afterFunc(idle, c.fire)
+	}
+	c.mu.Unlock()
+	return c, c.touch, func() { c.cancel(true, Canceled, nil) }
+}
+
+// ErrHeartbeatMissed 用WithHeartbeat建的ctx。 规定时间里没等到beat的时候的cause
+var ErrHeartbeatMissed = errors.New("context heartbeat missed")
+
+// WithHeartbeat 监工用的。 interval这么久没调beat。 ctx就取消。 Err()是DeadlineExceeded。 Cause()是ErrHeartbeatMissed
+// 干活的协程每隔一会调一次beat报个到。 卡死了就会被发现
+// 和WithIdleTimeout是一回事。 只是cause不一样
+func WithHeartbeat(parent Context, interval time.Duration) (ctx Context, beat func(), cancel CancelFunc) {
+	if parent == nil {
+		panic("cannot create context from nil parent")
+	}
+	c := &idleCtx{idle: interval, cause: ErrHeartbeatMissed}
+	c.deadline = time.Now().Add(interval)
+	c.cancelCtx.propagateCancel(parent, c)
+	c.mu.Lock()
+	if c.Err() == nil {
+		c.timer = afterFunc(interval, c.fire)
+	}
+	c.mu.Unlock()
+	return c, c.touch, func() { c.cancel(true, Canceled, nil) }
+}
+
+// idleCtx 是对timerCtx的继承。 截止日期会被touch往后推
+type idleCtx struct {
+	timerCtx
+	idle  time.Duration
+	cause error // cause when idle for too long, ErrHeartbeatMissed for WithHeartbeat
+}
+
+// touch 只改截止日期。 不动timer。 timer到点了自己会看截止日期是不是被推后了
+func (c *idleCtx) touch() {
+	c.mu.Lock()
+	if c.Err() == nil {
+		c.deadline = time.Now().Add(c.idle)
+	}
+	c.mu.Unlock()
+}
+
+// fire timer到点了。 截止日期被touch推后了就接着等剩下的时间。 没推后才是真的闲置超时了
+// 判断和重设都在锁里。 所以和touch同时发生也不会误取消
+func (c *idleCtx) fire() {
+	c.mu.Lock()
+	if c.Err() != nil || c.timer == nil {
+		c.mu.Unlock()
+		return
+	}
+	if d := time.Until(c.deadline); d > 0 {
+		c.timer.Reset(d)
+		c.mu.Unlock()
+		return
+	}
+	c.mu.Unlock()
+	c.cancel(true, DeadlineExceeded, c.cause)
+}
+
+// 截止日期会变。 要在锁里读
+func (c *idleCtx) Deadline() (deadline time.Time, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.deadline, true
+}
+
+func (c *idleCtx) String() string {
+	if c.cause == ErrHeartbeatMissed {
+		return contextName(c.cancelCtx.parent()) + ".WithHeartbeat(" +
+			c.idle.String() + ")"
+	}
+	return contextName(c.cancelCtx.parent()) + ".WithIdleTimeout(" +
+		c.idle.String() + ")"
+}
+
+func (c *idleCtx) cancel(removeFromParent bool, err, cause error) bool {
+	canceled := c.timerCtx.cancel(false, err, cause)
+	if removeFromParent {
+		removeChild(c.cancelCtx.parent(), c)
+	}
+	return canceled
+}
+
+// WithHardCap 用parent的截止日期。 但是最多只等hardCap这么久
+// 截止日期取 parent的截止日期 和 now+hardCap 里面早的那个。 parent没有截止日期就是 now+hardCap
+// WithDeadline本来就会比较parent的截止日期。 所以这里和WithTimeout是一回事。 只是名字把意图写清楚了
+func WithHardCap(parent Context, hardCap time.Duration) (Context, CancelFunc) {
+	return WithDeadline(parent, time.Now().Add(hardCap))
+}
+
+// WithLazyTimeout 超时时间不是从创建的时候开始算。而是调用start之后才开始计时
+// 适合排队的任务。排队的时间不算在超时里面。start之前没有自己的截止日期。 start多次调用只有第一次有用
+func WithLazyTimeout(parent Context, timeout time.Duration) (ctx Context, start func(), cancel CancelFunc) {
+	if parent == nil {
+		panic("cannot create context from nil parent")
+	}
+	c := &lazyTimerCtx{timeout: timeout}
+	c.cancelCtx.propagateCancel(parent, c)
+	return c, c.start, func() { c.cancel(true, Canceled, nil) }
+}
+
+// WithGraceThenDeadline 前grace这段时间没有截止日期。 grace过了之后才从那一刻开始算hard的超时
+// 其实就是WithLazyTimeout。 只是start交给一个grace的timer去调
+// grace的timer先放在c.timer里。 start的时候换成hard的timer。 所以任何时候取消都能把当前那个停掉
+func WithGraceThenDeadline(parent Context, grace, hard time.Duration) (Context, CancelFunc) {
+	ctx, start, cancel := WithLazyTimeout(parent, hard)
+	c := ctx.(*lazyTimerCtx)
+	c.mu.Lock()
+	c.grace = grace
+	if c.Err() == nil {
+		c.timer = afterFunc(grace, start)
+	}
+	c.mu.Unlock()
+	return c, cancel
+}
+
+// lazyTimerCtx 是对timerCtx的继承。 只是timer要等start了才装上
+type lazyTimerCtx struct {
+	timerCtx
+	timeout time.Duration
+	grace   time.Duration // set by WithGraceThenDeadline
+	started bool          // Under cancelCtx.mu.
+}
+
+func (c *lazyTimerCtx) start() {
+	// parent的截止日期要在拿自己的锁之前读。 parent的Deadline可能要拿parent的锁
+	// 取消的时候是拿着parent的锁再来拿我们的锁。 反过来拿就会死锁
+	cur, hasCur := c.cancelCtx.parent().Deadline()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// 已经开始了或者已经取消了。 就什么都不做
+	if c.started || c.Err() != nil {
+		return
+	}
+	c.started = true
+	c.deadline = time.Now().Add(c.timeout)
+	// parent的截止日期更早。 就不需要自己计时了。 parent到期了会把我们一起取消
+	if hasCur && cur.Before(c.deadline) {
+		c.deadline = cur
+		return
+	}
+	c.timer = afterFunc(c.timeout, func() {
+		c.cancel(true, DeadlineExceeded, nil)
+	})
+}
+
+// start之前。截止日期就是parent的截止日期
+// 和start一样。 不能拿着自己的锁去问parent
+func (c *lazyTimerCtx) Deadline() (deadline time.Time, ok bool) {
+	c.mu.Lock()
+	started, d := c.started, c.deadline
+	c.mu.Unlock()
+	if !started {
+		return c.cancelCtx.parent().Deadline()
+	}
+	return d, true
+}
+
+func (c *lazyTimerCtx) String() string {
+	if c.grace > 0 {
+		return contextName(c.cancelCtx.parent()) + ".WithGraceThenDeadline(" +
+			c.grace.String() + ", " + c.timeout.String() + ")"
+	}
+	return contextName(c.cancelCtx.parent()) + ".WithLazyTimeout(" +
+		c.timeout.String() + ")"
+}
+
+// 不能直接用timerCtx的cancel。 parent的children里面存的是lazyTimerCtx。 父子分离要用它自己
+func (c *lazyTimerCtx) cancel(removeFromParent bool, err, cause error) bool {
+	canceled := c.timerCtx.cancel(false, err, cause)
+	if removeFromParent {
+		removeChild(c.cancelCtx.parent(), c)
+	}
+	return canceled
+}
@@ -0,0 +1,426 @@
+package context
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDeadlineThenCancelKeepsCause(t *testing.T) {
+	x := errors.New("too slow")
+	ctx, cancel := WithTimeoutCause(Background(), time.Millisecond, x)
+	<-ctx.Done()
+	cancel()
+	if err := ctx.Err(); err != DeadlineExceeded {
+		t.Errorf("Err() = %v, want %v", err, DeadlineExceeded)
+	}
+	if got := Cause(ctx); got != x {
+		t.Errorf("Cause = %v, want %v", got, x)
+	}
+}
+
+func TestCancelThenDeadlineKeepsCause(t *testing.T) {
+	ctx, cancel := WithTimeout(Background(), 5*time.Millisecond)
+	cancel()
+	time.Sleep(20 * time.Millisecond)
+	if err := ctx.Err(); err != Canceled {
+		t.Errorf("Err() = %v, want %v", err, Canceled)
+	}
+	if got := Cause(ctx); got != Canceled {
+		t.Errorf("Cause = %v, want %v", got, Canceled)
+	}
+}
+
+// 截止日期和手动取消一起来。 谁先到听谁的。 Err和Cause一定是同一次取消的
+func TestDeadlineCancelRace(t *testing.T) {
+	x := errors.New("too slow")
+	for range 200 {
+		ctx, cancel := WithTimeoutCause(Background(), time.Microsecond, x)
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cancel()
+		}()
+		<-ctx.Done()
+		wg.Wait()
+		cancel()
+		switch err, cause := ctx.Err(), Cause(ctx); {
+		case err == DeadlineExceeded && cause == x:
+		case err == Canceled && cause == Canceled:
+		default:
+			t.Fatalf("Err() = %v with Cause = %v", err, cause)
+		}
+	}
+}
+
+func TestWithHardCap(t *testing.T) {
+	parent, cancelParent := WithTimeout(Background(), time.Hour)
+	defer cancelParent()
+	const hardCap = 50 * time.Millisecond
+	start := time.Now()
+	ctx, cancel := WithHardCap(parent, hardCap)
+	defer cancel()
+
+	d, ok := ctx.Deadline()
+	if !ok || d.After(start.Add(hardCap+time.Second)) {
+		t.Fatalf("Deadline = %v, %v; want about %v from now", d, ok, hardCap)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("hard cap did not fire")
+	}
+	if elapsed := time.Since(start); elapsed < hardCap {
+		t.Errorf("fired after %v, before the cap of %v", elapsed, hardCap)
+	}
+	if err := ctx.Err(); err != DeadlineExceeded {
+		t.Fatalf("Err() = %v, want %v", err, DeadlineExceeded)
+	}
+
+	// 没有截止日期的parent就是now+cap
+	ctx, cancel = WithHardCap(Background(), time.Hour)
+	defer cancel()
+	if d, ok := ctx.Deadline(); !ok || time.Until(d) > time.Hour {
+		t.Fatalf("Deadline = %v, %v; want within an hour", d, ok)
+	}
+}
+
+func TestWithIdleTimeout(t *testing.T) {
+	const idle = 50 * time.Millisecond
+	ctx, touch, cancel := WithIdleTimeout(Background(), idle)
+	defer cancel()
+	// 一直touch的话。 加起来远超idle也不会取消
+	for i := 0; i < 10; i++ {
+		time.Sleep(idle / 5)
+		touch()
+		if err := ctx.Err(); err != nil {
+			t.Fatalf("after touch %d: Err() = %v, want nil", i, err)
+		}
+	}
+	// 不touch了就会到点
+	select {
+	case <-ctx.Done():
+	case <-time.After(10 * idle):
+		t.Fatal("ctx not canceled after touches stopped")
+	}
+	if err := ctx.Err(); err != DeadlineExceeded {
+		t.Errorf("Err() = %v, want %v", err, DeadlineExceeded)
+	}
+}
+
+func TestWithDeadlineEqualParent(t *testing.T) {
+	d := time.Now().Add(time.Hour)
+	parent, cancelParent := WithDeadline(Background(), d)
+	defer cancelParent()
+	ctx, cancel := WithDeadline(parent, d)
+	defer cancel()
+	// 截止日期一样就不该再建一个timer
+	if _, ok := ctx.(*timerCtx); ok {
+		t.Errorf("WithDeadline(parent, parent deadline) made a *timerCtx, want a plain cancel ctx")
+	}
+	if got, ok := ctx.Deadline(); !ok || !got.Equal(d) {
+		t.Errorf("Deadline() = %v, %v, want %v, true", got, ok, d)
+	}
+	// parent到期照样把它带走
+	cancelParent()
+	if err := ctx.Err(); err != Canceled {
+		t.Errorf("Err() after parent cancel = %v, want %v", err, Canceled)
+	}
+}
+
+func TestCanceledByDeadline(t *testing.T) {
+	parent, cancelParent := WithTimeout(Background(), time.Millisecond)
+	defer cancelParent()
+	child, cancelChild := WithCancel(WithValue(parent, "k", 1))
+	defer cancelChild()
+	if CanceledByDeadline(child) {
+		t.Error("CanceledByDeadline(live child) = true, want false")
+	}
+	<-child.Done()
+	// 孩子自己没有timer。 是parent到期带下来的
+	if !CanceledByDeadline(child) {
+		t.Errorf("CanceledByDeadline(child of expired parent) = false, want true; Err() = %v", child.Err())
+	}
+
+	ctx, cancel := WithTimeout(Background(), time.Hour)
+	cancel()
+	if CanceledByDeadline(ctx) {
+		t.Error("CanceledByDeadline(explicitly canceled) = true, want false")
+	}
+}
+
+func TestWithGraceThenDeadline(t *testing.T) {
+	const grace, hard = 30 * time.Millisecond, 30 * time.Millisecond
+	ctx, cancel := WithGraceThenDeadline(Background(), grace, hard)
+	defer cancel()
+	if d, ok := ctx.Deadline(); ok {
+		t.Errorf("Deadline() in grace = %v, true, want no deadline", d)
+	}
+	time.Sleep(2 * grace)
+	armed := time.Now()
+	d, ok := ctx.Deadline()
+	if !ok {
+		t.Fatal("Deadline() after grace = false, want the armed deadline")
+	}
+	if d.After(armed.Add(hard)) {
+		t.Errorf("Deadline() = %v, want no later than %v", d, armed.Add(hard))
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("ctx not canceled after the hard deadline")
+	}
+	if err := ctx.Err(); err != DeadlineExceeded {
+		t.Errorf("Err() = %v, want %v", err, DeadlineExceeded)
+	}
+}
+
+func TestWithGraceThenDeadlineCancelInGrace(t *testing.T) {
+	ctx, cancel := WithGraceThenDeadline(Background(), time.Hour, time.Hour)
+	c := ctx.(*lazyTimerCtx)
+	c.mu.Lock()
+	timer := c.timer
+	c.mu.Unlock()
+	cancel()
+	// grace的timer已经被取消停掉了。 再Stop就是false
+	if timer.Stop() {
+		t.Error("grace timer still pending after cancel")
+	}
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("Deadline() armed after cancel in grace, want none")
+	}
+}
+
+func TestWithLazyTimeout(t *testing.T) {
+	const timeout = 20 * time.Millisecond
+	ctx, start, cancel := WithLazyTimeout(Background(), timeout)
+	defer cancel()
+	if d, ok := ctx.Deadline(); ok {
+		t.Errorf("Deadline() before start = %v, true, want no deadline", d)
+	}
+	// 没start就永远不会到期
+	time.Sleep(2 * timeout)
+	if err := ctx.Err(); err != nil {
+		t.Fatalf("Err() before start = %v, want nil", err)
+	}
+
+	before := time.Now()
+	start()
+	d, ok := ctx.Deadline()
+	if !ok || d.Before(before.Add(timeout)) {
+		t.Errorf("Deadline() after start = %v, %v, want at least %v", d, ok, before.Add(timeout))
+	}
+	// 第二次start什么都不做
+	start()
+	if d2, _ := ctx.Deadline(); !d2.Equal(d) {
+		t.Errorf("Deadline() after second start = %v, want unchanged %v", d2, d)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("ctx not canceled after start and timeout")
+	}
+	if err := ctx.Err(); err != DeadlineExceeded {
+		t.Errorf("Err() = %v, want %v", err, DeadlineExceeded)
+	}
+}
+
+// TestLazyTimeoutLockOrder 取消是先拿parent的锁再拿孩子的锁
+// start和Deadline去问parent的时候不能拿着自己的锁。 不然和取消碰上就死锁
+func TestLazyTimeoutLockOrder(t *testing.T) {
+	for _, name := range []string{"start", "Deadline"} {
+		parent, _, cancelParent := WithIdleTimeout(Background(), time.Hour)
+		ctx, start, cancel := WithLazyTimeout(parent, time.Hour)
+		p := parent.(*idleCtx)
+		c := ctx.(*lazyTimerCtx)
+
+		// 假装parent正在取消。 拿着parent的锁
+		p.mu.Lock()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			if name == "start" {
+				start()
+			} else {
+				ctx.Deadline()
+			}
+		}()
+		time.Sleep(10 * time.Millisecond)
+		// 取消接下来要拿孩子的锁。 这时候孩子的锁不能被占着
+		if !c.mu.TryLock() {
+			p.mu.Unlock()
+			<-done
+			t.Fatalf("%s holds the child lock while waiting for the parent", name)
+		}
+		c.mu.Unlock()
+		p.mu.Unlock()
+		<-done
+		cancel()
+		cancelParent()
+	}
+}
+
+func TestTryExtendDeadline(t *testing.T) {
+	ctx, cancel := WithTimeout(Background(), 20*time.Millisecond)
+	defer cancel()
+	old, _ := ctx.Deadline()
+	want := time.Now().Add(time.Hour)
+	if !TryExtendDeadline(ctx, want) {
+		t.Fatal("TryExtendDeadline = false, want true")
+	}
+	if got, _ := ctx.Deadline(); !got.Equal(want) {
+		t.Errorf("Deadline() = %v, want %v", got, want)
+	}
+	// 原来的时间过了也不会到期
+	time.Sleep(40 * time.Millisecond)
+	if err := ctx.Err(); err != nil {
+		t.Fatalf("Err() after the old deadline %v = %v, want nil", old, err)
+	}
+	// 往前挪不行
+	if TryExtendDeadline(ctx, want.Add(-time.Minute)) {
+		t.Error("TryExtendDeadline to an earlier time = true, want false")
+	}
+	// 不是WithDeadline建的不行
+	plain, cancelPlain := WithCancel(Background())
+	defer cancelPlain()
+	if TryExtendDeadline(plain, want) {
+		t.Error("TryExtendDeadline on WithCancel = true, want false")
+	}
+}
+
+func TestTryExtendDeadlineParentCap(t *testing.T) {
+	parent, cancelParent := WithTimeout(Background(), time.Hour)
+	defer cancelParent()
+	limit, _ := parent.Deadline()
+	ctx, cancel := WithTimeout(parent, time.Minute)
+	defer cancel()
+	if !TryExtendDeadline(ctx, limit.Add(time.Hour)) {
+		t.Fatal("TryExtendDeadline past the parent = false, want true (capped)")
+	}
+	if got, _ := ctx.Deadline(); !got.Equal(limit) {
+		t.Errorf("Deadline() = %v, want the parent deadline %v", got, limit)
+	}
+	// 已经到了parent的截止日期。 再往后挪不动
+	if TryExtendDeadline(ctx, limit.Add(2*time.Hour)) {
+		t.Error("TryExtendDeadline beyond the parent again = true, want false")
+	}
+}
+
+func TestTryExtendDeadlineAfterExpiry(t *testing.T) {
+	ctx, cancel := WithTimeout(Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	if TryExtendDeadline(ctx, time.Now().Add(time.Hour)) {
+		t.Error("TryExtendDeadline after expiry = true, want false")
+	}
+	if err := ctx.Err(); err != DeadlineExceeded {
+		t.Errorf("Err() = %v, want %v", err, DeadlineExceeded)
+	}
+}
+
+func TestWithHeartbeat(t *testing.T) {
+	const interval = 30 * time.Millisecond
+	ctx, beat, cancel := WithHeartbeat(Background(), interval)
+	defer cancel()
+	// 按时报到。 加起来远超interval也不会取消
+	for i := 0; i < 8; i++ {
+		time.Sleep(interval / 3)
+		beat()
+	}
+	if err := ctx.Err(); err != nil {
+		t.Fatalf("Err() while beating = %v, want nil", err)
+	}
+	// 不报到了。 以ErrHeartbeatMissed取消
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("ctx not canceled after a missed beat")
+	}
+	if err := ctx.Err(); err != DeadlineExceeded {
+		t.Errorf("Err() = %v, want %v", err, DeadlineExceeded)
+	}
+	if got := Cause(ctx); got != ErrHeartbeatMissed {
+		t.Errorf("Cause() = %v, want %v", got, ErrHeartbeatMissed)
+	}
+
+	// 手动取消的不算漏了心跳
+	ctx, _, cancel = WithHeartbeat(Background(), time.Hour)
+	cancel()
+	if got := Cause(ctx); got != Canceled {
+		t.Errorf("Cause() after cancel = %v, want %v", got, Canceled)
+	}
+}
+
+func TestReusableTimer(t *testing.T) {
+	rt := NewReusableTimer(Background())
+	ctx := rt.Reset(time.Hour)
+	// 还活着的时候Reset改的是同一个ctx
+	before := time.Now()
+	if got := rt.Reset(2 * time.Hour); got != ctx {
+		t.Fatal("Reset on a live ctx returned a new ctx")
+	}
+	if d, _ := ctx.Deadline(); d.Before(before.Add(2 * time.Hour)) {
+		t.Errorf("Deadline() after Reset = %v, want at least %v", d, before.Add(2*time.Hour))
+	}
+
+	// 到期了之后Reset建一个新的。 旧的还是到期的
+	ctx = rt.Reset(time.Millisecond)
+	<-ctx.Done()
+	next := rt.Reset(time.Hour)
+	if next == ctx {
+		t.Fatal("Reset after expiry returned the expired ctx")
+	}
+	if err := next.Err(); err != nil {
+		t.Errorf("new ctx after expiry: Err() = %v, want nil", err)
+	}
+	if err := ctx.Err(); err != DeadlineExceeded {
+		t.Errorf("old ctx: Err() = %v, want %v", err, DeadlineExceeded)
+	}
+
+	// Stop是取消。 之后还能再Reset
+	rt.Stop()
+	rt.Stop()
+	if err := next.Err(); err != Canceled {
+		t.Errorf("Err() after Stop = %v, want %v", err, Canceled)
+	}
+	if ctx := rt.Reset(time.Hour); ctx.Err() != nil {
+		t.Errorf("Reset after Stop: Err() = %v, want nil", ctx.Err())
+	}
+	rt.Stop()
+}
+
+func TestReusableTimerRace(t *testing.T) {
+	parent, cancel := WithCancel(Background())
+	defer cancel()
+	p := parent.(*cancelCtx)
+	rt := NewReusableTimer(parent)
+	for i := range 500 {
+		// 定时器响了但还没取消完的时候Reset。 要给一个活着的ctx
+		ctx := rt.Reset(time.Duration(i%50) * time.Microsecond)
+		if i%2 == 0 {
+			if next := rt.Reset(time.Hour); next.Err() != nil {
+				t.Fatalf("round %d: Reset returned a done ctx: %v", i, next.Err())
+			}
+		}
+		// Stop和定时器抢。 谁赢都行。 但ctx一定要结束
+		rt.Stop()
+		select {
+		case <-ctx.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("round %d: ctx not done after Stop", i)
+		}
+		if err := ctx.Err(); err != Canceled && err != DeadlineExceeded {
+			t.Fatalf("round %d: Err() = %v", i, err)
+		}
+	}
+	// 旧的ctx都从parent上摘掉了
+	n := int(p.nfew.Load())
+	if s := p.kids.Load(); s != nil {
+		n += s.len()
+	}
+	if n != 0 {
+		t.Errorf("parent still has %d children after Stop", n)
+	}
+}
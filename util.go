@@ -0,0 +1,181 @@
+package context
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// OrDefault 等result的结果。 ctx先取消了就返回def
+// ctx永远不会取消(Done()是nil)的话。 就只等result
+func OrDefault[T any](ctx Context, result <-chan T, def T) T {
+	done := ctx.Done()
+	if done == nil {
+		return <-result
+	}
+	select {
+	case v := <-result:
+		return v
+	case <-done:
+		return def
+	}
+}
+
+// Tick 每隔d发一次时间。 ctx取消了就停掉并且把channel关了
+// 就是NewTicker(ctx, d).C。 不需要中途Stop或者Reset的时候用它
+func Tick(ctx Context, d time.Duration) <-chan time.Time {
+	return NewTicker(ctx, d).C
+}
+
+// Ticker 和time.Ticker一样。 只是ctx结束了(或者Stop了)C会关掉。 底下的time.Ticker也会停掉
+// for/select里用time.Ticker忘了Stop就漏了。 这个跟着ctx走。 不会漏
+type Ticker struct {
+	C <-chan time.Time
+
+	t    *time.Ticker
+	stop chan struct{}
+	once sync.Once
+}
+
+// NewTicker 每隔d往C里发一次时间
+// 转发和看ctx在同一个协程里。 所以不用再单独开一个协程等Done
+// channel不带缓冲。 取消之后不会再收到之前攒下来的tick
+func NewTicker(ctx Context, d time.Duration) *Ticker {
+	ch := make(chan time.Time)
+	t := &Ticker{C: ch, t: time.NewTicker(d), stop: make(chan struct{})}
+	go func() {
+		defer close(ch)
+		defer t.t.Stop()
+		done := ctx.Done()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.stop:
+				return
+			case now := <-t.t.C:
+				select {
+				case ch <- now:
+				case <-done:
+					return
+				case <-t.stop:
+					return
+				}
+			}
+		}
+	}()
+	return t
+}
+
+// Stop 停掉。 C会关掉。 调多次没事
+func (t *Ticker) Stop() {
+	t.once.Do(func() { close(t.stop) })
+}
+
+// Reset 改成每隔d发一次
+func (t *Ticker) Reset(d time.Duration) {
+	t.t.Reset(d)
+}
+
+// Sleep 睡d这么久。 ctx先结束了就提前醒。 返回Cause(ctx)
+// 睡够了返回nil。 d<=0不睡。 ctx已经结束了的话还是返回Cause(ctx)
+// 定时器在返回之前就停掉了。 不会留着
+func Sleep(ctx Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return Cause(ctx)
+	}
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return Cause(ctx)
+	case <-t.C:
+		return nil
+	}
+}
+
+// WaitAll 等所有的ctx都结束。 按传进来的顺序返回它们的Err()
+// Done()是nil的ctx永远不会结束。 不等它。 对应位置直接返回nil
+func WaitAll(ctxs ...Context) []error {
+	errs := make([]error, len(ctxs))
+	for i, ctx := range ctxs {
+		done := ctx.Done()
+		if done == nil {
+			continue
+		}
+		<-done
+		errs[i] = ctx.Err()
+	}
+	return errs
+}
+
+// TryRecv 不阻塞地看一眼ctx和ch
+// ctx已经结束了就返回err=ctx.Err()。 ch里有值就返回这个值和ok=true。 都没有就是ok=false err=nil
+// 两个都好了的时候取消优先。 ch关了也是ok=false
+func TryRecv[T any](ctx Context, ch <-chan T) (val T, ok bool, err error) {
+	select {
+	case <-ctx.Done():
+		return val, false, ctx.Err()
+	default:
+	}
+	select {
+	case val, ok = <-ch:
+		return val, ok, nil
+	default:
+		return val, false, nil
+	}
+}
+
+// ErrChannelClosed Recv的时候channel已经关了
+var ErrChannelClosed = errors.New("context: channel closed")
+
+// Send 把v发到ch。 ctx先结束了就不发了。 返回Cause(ctx)
+// ctx已经结束了的话。 ch有空位也不发
+func Send[T any](ctx Context, ch chan<- T, v T) error {
+	if ctx.Err() != nil {
+		return Cause(ctx)
+	}
+	select {
+	case ch <- v:
+		return nil
+	case <-ctx.Done():
+		return Cause(ctx)
+	}
+}
+
+// Recv 从ch收一个。 ctx先结束了返回Cause(ctx)。 ch关了返回ErrChannelClosed
+// ctx已经结束了的话。 ch里有值也不收
+func Recv[T any](ctx Context, ch <-chan T) (T, error) {
+	var zero T
+	if ctx.Err() != nil {
+		return zero, Cause(ctx)
+	}
+	select {
+	case v, ok := <-ch:
+		if !ok {
+			return zero, ErrChannelClosed
+		}
+		return v, nil
+	case <-ctx.Done():
+		return zero, Cause(ctx)
+	}
+}
+
+// Collect 一直收到ch关掉。 返回收到的全部和nil
+// ctx先结束了。 返回已经收到的和Cause(ctx)
+func Collect[T any](ctx Context, ch <-chan T) ([]T, error) {
+	var out []T
+	for {
+		v, err := Recv(ctx, ch)
+		if err == ErrChannelClosed {
+			return out, nil
+		}
+		if err != nil {
+			return out, err
+		}
+		out = append(out, v)
+	}
+}
@@ -0,0 +1,269 @@
+package context
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestOrDefault(t *testing.T) {
+	ready := make(chan int, 1)
+	ready <- 1
+	ctx, cancel := WithCancel(Background())
+	defer cancel()
+	if got := OrDefault(ctx, ready, -1); got != 1 {
+		t.Errorf("result ready: OrDefault = %d, want 1", got)
+	}
+
+	cancel()
+	if got := OrDefault(ctx, make(chan int), -1); got != -1 {
+		t.Errorf("ctx canceled: OrDefault = %d, want -1", got)
+	}
+
+	ready <- 2
+	if got := OrDefault(Background(), ready, -1); got != 2 {
+		t.Errorf("nil Done: OrDefault = %d, want 2", got)
+	}
+}
+
+func TestTick(t *testing.T) {
+	ctx, cancel := WithCancel(Background())
+	ticks := Tick(ctx, time.Millisecond)
+	for range 3 {
+		select {
+		case <-ticks:
+		case <-time.After(5 * time.Second):
+			t.Fatal("no tick")
+		}
+	}
+	cancel()
+	// 取消的时候可能已经有一个在路上了。 之后chan要很快关掉
+	deadline := time.After(5 * time.Second)
+	for n := 0; ; n++ {
+		select {
+		case _, ok := <-ticks:
+			if !ok {
+				return
+			}
+			if n > 1 {
+				t.Fatal("ticks kept arriving after cancel")
+			}
+		case <-deadline:
+			t.Fatal("tick channel not closed after cancel")
+		}
+	}
+}
+
+// waitClosed 等C关掉。 关之前最多再收到一个在路上的tick
+func waitClosed(t *testing.T, c <-chan time.Time) {
+	t.Helper()
+	deadline := time.After(5 * time.Second)
+	for n := 0; ; n++ {
+		select {
+		case _, ok := <-c:
+			if !ok {
+				return
+			}
+			if n > 0 {
+				t.Fatal("ticks kept arriving after stop")
+			}
+		case <-deadline:
+			t.Fatal("tick channel not closed after stop")
+		}
+	}
+}
+
+func TestTicker(t *testing.T) {
+	ctx, cancel := WithCancel(Background())
+	defer cancel()
+	tk := NewTicker(ctx, time.Millisecond)
+	select {
+	case <-tk.C:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no tick")
+	}
+	// Reset成很久以后。 之前攒下来的不会再发
+	tk.Reset(time.Hour)
+	select {
+	case <-tk.C:
+		// 可能是Reset之前已经在路上的那一个
+	case <-time.After(10 * time.Millisecond):
+	}
+	select {
+	case <-tk.C:
+		t.Fatal("tick after Reset(time.Hour)")
+	case <-time.After(30 * time.Millisecond):
+	}
+
+	// Stop关掉C。 调多次没事。 ctx还活着
+	tk.Reset(time.Millisecond)
+	tk.Stop()
+	tk.Stop()
+	waitClosed(t, tk.C)
+	if ctx.Err() != nil {
+		t.Error("Ticker.Stop canceled the ctx")
+	}
+
+	// ctx取消了也一样。 之后再Stop也没事
+	tk = NewTicker(ctx, time.Millisecond)
+	cancel()
+	waitClosed(t, tk.C)
+	tk.Stop()
+}
+
+func TestWaitAll(t *testing.T) {
+	timeouts := []time.Duration{30 * time.Millisecond, 80 * time.Millisecond, 10 * time.Millisecond}
+	ctxs := make([]Context, len(timeouts))
+	for i, d := range timeouts {
+		ctx, cancel := WithTimeout(Background(), d)
+		defer cancel()
+		ctxs[i] = ctx
+	}
+	canceled, cancel := WithCancel(Background())
+	cancel()
+	ctxs = append(ctxs, canceled, Background())
+
+	start := time.Now()
+	errs := WaitAll(ctxs...)
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("WaitAll returned after %v, want at least the longest timeout 80ms", elapsed)
+	}
+	want := []error{DeadlineExceeded, DeadlineExceeded, DeadlineExceeded, Canceled, nil}
+	if len(errs) != len(want) {
+		t.Fatalf("len(errs) = %d, want %d", len(errs), len(want))
+	}
+	for i := range want {
+		if errs[i] != want[i] {
+			t.Errorf("errs[%d] = %v, want %v", i, errs[i], want[i])
+		}
+	}
+}
+
+func TestTryRecv(t *testing.T) {
+	ch := make(chan int, 1)
+	ch <- 7
+	if v, ok, err := TryRecv(Background(), ch); v != 7 || !ok || err != nil {
+		t.Errorf("TryRecv(ready) = %v, %v, %v, want 7, true, nil", v, ok, err)
+	}
+	if v, ok, err := TryRecv(Background(), ch); v != 0 || ok || err != nil {
+		t.Errorf("TryRecv(empty) = %v, %v, %v, want 0, false, nil", v, ok, err)
+	}
+	ctx, cancel := WithCancel(Background())
+	cancel()
+	if v, ok, err := TryRecv(ctx, ch); v != 0 || ok || err != Canceled {
+		t.Errorf("TryRecv(canceled) = %v, %v, %v, want 0, false, %v", v, ok, err, Canceled)
+	}
+}
+
+func TestSleep(t *testing.T) {
+	// 睡够了返回nil
+	start := time.Now()
+	if err := Sleep(Background(), 20*time.Millisecond); err != nil {
+		t.Errorf("full sleep: Sleep = %v, want nil", err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("Sleep returned after %v, want at least 20ms", elapsed)
+	}
+	if err := Sleep(Background(), 0); err != nil {
+		t.Errorf("Sleep(0) = %v, want nil", err)
+	}
+
+	// 睡到一半取消。 马上醒。 返回cause
+	boom := errors.New("boom")
+	ctx, cancel := WithCancelCause(Background())
+	time.AfterFunc(10*time.Millisecond, func() { cancel(boom) })
+	start = time.Now()
+	if err := Sleep(ctx, time.Hour); err != boom {
+		t.Errorf("canceled sleep: Sleep = %v, want %v", err, boom)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Sleep woke %v after cancel", elapsed)
+	}
+
+	// 已经取消了的话d<=0也返回cause
+	if err := Sleep(ctx, 0); err != boom {
+		t.Errorf("canceled ctx: Sleep(0) = %v, want %v", err, boom)
+	}
+	// 超时的ctx返回的是DeadlineExceeded
+	ctx, cancelTimeout := WithTimeout(Background(), 10*time.Millisecond)
+	defer cancelTimeout()
+	if err := Sleep(ctx, time.Hour); err != DeadlineExceeded {
+		t.Errorf("expired sleep: Sleep = %v, want %v", err, DeadlineExceeded)
+	}
+}
+
+func TestSend(t *testing.T) {
+	ch := make(chan int, 1)
+	if err := Send(Background(), ch, 1); err != nil || <-ch != 1 {
+		t.Fatalf("Send with room = %v, want nil", err)
+	}
+
+	// 没人收。 阻塞到取消
+	boom := errors.New("boom")
+	ctx, cancel := WithCancelCause(Background())
+	time.AfterFunc(10*time.Millisecond, func() { cancel(boom) })
+	if err := Send(ctx, make(chan int), 1); err != boom {
+		t.Errorf("blocked then canceled: Send = %v, want %v", err, boom)
+	}
+	// 已经取消了的话有空位也不发
+	if err := Send(ctx, ch, 2); err != boom {
+		t.Errorf("canceled ctx: Send = %v, want %v", err, boom)
+	}
+	if len(ch) != 0 {
+		t.Error("Send on a canceled ctx put a value in the channel")
+	}
+}
+
+func TestRecv(t *testing.T) {
+	ch := make(chan int, 1)
+	ch <- 1
+	if v, err := Recv(Background(), ch); v != 1 || err != nil {
+		t.Errorf("Recv(ready) = %v, %v, want 1, nil", v, err)
+	}
+
+	boom := errors.New("boom")
+	ctx, cancel := WithCancelCause(Background())
+	time.AfterFunc(10*time.Millisecond, func() { cancel(boom) })
+	if v, err := Recv(ctx, ch); v != 0 || err != boom {
+		t.Errorf("blocked then canceled: Recv = %v, %v, want 0, %v", v, err, boom)
+	}
+	// 已经取消了的话有值也不收
+	ch <- 2
+	if v, err := Recv(ctx, ch); v != 0 || err != boom {
+		t.Errorf("canceled ctx: Recv = %v, %v, want 0, %v", v, err, boom)
+	}
+	if len(ch) != 1 {
+		t.Error("Recv on a canceled ctx took the value")
+	}
+
+	close(ch)
+	<-ch
+	if v, err := Recv(Background(), ch); v != 0 || err != ErrChannelClosed {
+		t.Errorf("closed: Recv = %v, %v, want 0, %v", v, err, ErrChannelClosed)
+	}
+}
+
+func TestCollect(t *testing.T) {
+	ch := make(chan int, 3)
+	ch <- 1
+	ch <- 2
+	ch <- 3
+	close(ch)
+	if got, err := Collect(Background(), ch); !slices.Equal(got, []int{1, 2, 3}) || err != nil {
+		t.Errorf("Collect(closed) = %v, %v, want [1 2 3], nil", got, err)
+	}
+
+	// 收了两个之后取消。 返回已经收到的
+	ch = make(chan int)
+	ctx, cancel := WithCancel(Background())
+	go func() {
+		ch <- 1
+		ch <- 2
+		cancel()
+	}()
+	got, err := Collect(ctx, ch)
+	if !slices.Equal(got, []int{1, 2}) || err != Canceled {
+		t.Errorf("Collect(canceled) = %v, %v, want [1 2], %v", got, err, Canceled)
+	}
+}
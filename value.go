@@ -0,0 +1,506 @@
+package context
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FilterValues 过滤parent的值。 allow(key)为true才能看到。 不然就是nil
+// 取消和截止日期照样从parent来。 用在把ctx交给不信任的插件的时候。 只给它看白名单里的值
+func FilterValues(parent Context, allow func(key any) bool) Context {
+	if parent == nil {
+		panic("cannot create context from nil parent")
+	}
+	return hooked(&filterCtx{parent, allow})
+}
+
+type filterCtx struct {
+	Context
+	allow func(key any) bool
+}
+
+func (c *filterCtx) Value(key any) any {
+	// 包里自己用的key一定要放过去。 不然取消挂不上去。 SoftDone RegisterWorker也找不到上面的节点
+	if internalKey(key) || c.allow(key) {
+		return value(c.Context, key)
+	}
+	hookLookup(c, key, false)
+	return nil
+}
+
+func (c *filterCtx) String() string {
+	return contextName(c.Context) + ".FilterValues"
+}
+
+// WithoutValue 从这里往下查key都是nil。 parent那边的值原样留着。 别的ctx照样能查到
+// 用来不让密钥或者租户的值漏到不该看的子操作里
+// 和WithValue(parent, key, nil)效果一样。 只是意思更清楚
+func WithoutValue(parent Context, key any) Context {
+	if parent == nil {
+		panic("cannot create context from nil parent")
+	}
+	checkKey(key)
+	return hooked(&withoutValueCtx{parent, key})
+}
+
+type withoutValueCtx struct {
+	Context
+	key any
+}
+
+func (c *withoutValueCtx) Value(key any) any {
+	if c.key == key {
+		hookLookup(c, key, false)
+		return nil
+	}
+	return value(c.Context, key)
+}
+
+func (c *withoutValueCtx) String() string {
+	return contextName(c.Context) + ".WithoutValue(" + keyString(c.key) + ")"
+}
+
+// context kv存储功能
+func WithValue(parent Context, key, val any) Context {
+	if parent == nil {
+		panic("cannot create context from nil parent")
+	}
+	checkKey(key)
+	if vc, ok := val.(Context); ok && isAncestor(vc, parent) {
+		panic("context stored as a value of itself or its descendant")
+	}
+	if FlattenDepth > 0 {
+		if c := flatten(parent, key, val); c != nil {
+			return hooked(c)
+		}
+	}
+	return hooked(&valueCtx{parent, key, val})
+}
+
+// WithValues 一次存好几个值。 kv是 key1, val1, key2, val2 ... 这样排的
+// 和连着调好几次WithValue一样。 只是都放在一个节点里。 查值的时候不用一层一层往上跳
+// 同一个key出现好几次的话。 后面的算数
+// key和WithValue一样要能比较。 在这里一次检查完。 以后查值不用再检查
+func WithValues(parent Context, kv ...any) Context {
+	if parent == nil {
+		panic("cannot create context from nil parent")
+	}
+	if len(kv)%2 != 0 {
+		panic("odd number of key/value arguments")
+	}
+	vals := make(map[any]any, len(kv)/2)
+	keys := make([]string, 0, len(kv)/2)
+	for i := 0; i < len(kv); i += 2 {
+		key, val := kv[i], kv[i+1]
+		checkKey(key)
+		if vc, ok := val.(Context); ok && isAncestor(vc, parent) {
+			panic("context stored as a value of itself or its descendant")
+		}
+		vals[key] = val
+		keys = append(keys, keyString(key))
+	}
+	return hooked(&valuesCtx{parent, vals, "WithValues(" + strings.Join(keys, ", ") + ")"})
+}
+
+// isAncestor a是不是c自己或者c的祖先
+// 把ctx当值存进自己下面。 打印和遍历值的时候就绕回来了
+func isAncestor(a, c Context) bool {
+	// Background() 这些根都是空结构体。 谁和谁都相等。 存它们也绕不回来
+	switch a.(type) {
+	case backgroundCtx, todoCtx, emptyCtx:
+		return false
+	}
+	// 类型不能比较的话。 ==会panic。 这种也不可能是同一个
+	if !reflect.TypeOf(a).Comparable() {
+		return false
+	}
+	for ; c != nil; c = parentOf(c) {
+		if c == a {
+			return true
+		}
+	}
+	return false
+}
+
+// checkKey 存值之前检查key能不能用
+func checkKey(key any) {
+	if key == nil {
+		panic("nil key")
+	}
+	// &cancelCtxKey 是内部用来找cancelCtx的。 不能让用户拿它当key。不然value()里面就分不清了
+	// 其他的指针。包括*cancelCtx 都只是普通的key
+	if key == any(&cancelCtxKey) {
+		panic("reserved key")
+	}
+	// TODO:如果key不是可以比较类型。为什么不能存储
+	if !reflect.TypeOf(key).Comparable() {
+		panic("key is not comparable")
+	}
+}
+
+// WithValueFunc 存一个懒加载的值。 第一次有人查key的时候才调f算出来。 以后都用这个结果
+// f最多跑一次。 好几个协程同时查的话。 其他的等第一个算完
+// 请求里用不上的贵东西(解析token 开数据库会话)就不用白建了
+func WithValueFunc(parent Context, key any, f func() any) Context {
+	if parent == nil {
+		panic("cannot create context from nil parent")
+	}
+	checkKey(key)
+	if f == nil {
+		panic("nil value func")
+	}
+	return hooked(&lazyValueCtx{Context: parent, key: key, f: f})
+}
+
+type lazyValueCtx struct {
+	Context
+	key  any
+	once sync.Once
+	f    func() any
+	val  any
+}
+
+// get 算过了就直接返回。 没算过就现在算
+func (c *lazyValueCtx) get() any {
+	c.once.Do(func() {
+		c.val = c.f()
+		c.f = nil
+	})
+	return c.val
+}
+
+func (c *lazyValueCtx) Value(key any) any {
+	if c.key == key {
+		hookLookup(c, key, true)
+		return c.get()
+	}
+	return value(c.Context, key)
+}
+
+// String 不会去调f。 打个日志不能把值给算出来
+func (c *lazyValueCtx) String() string {
+	return contextName(c.Context) + ".WithValueFunc(" + keyString(c.key) + ")"
+}
+
+// WithValueTTL 存一个会过期的值。 过了ttl之后就当没存过。 继续往parent找
+// 过没过期是每次Value()的时候拿当时的时间现算的
+func WithValueTTL(parent Context, key, val any, ttl time.Duration) Context {
+	if parent == nil {
+		panic("cannot create context from nil parent")
+	}
+	checkKey(key)
+	return hooked(&ttlValueCtx{valueCtx{parent, key, val}, time.Now(), ttl})
+}
+
+type ttlValueCtx struct {
+	valueCtx
+	created time.Time
+	ttl     time.Duration
+}
+
+func (c *ttlValueCtx) Value(key any) any {
+	if c.key == key && time.Since(c.created) < c.ttl {
+		hookLookup(c, key, true)
+		return c.val
+	}
+	return value(c.Context, key)
+}
+
+func (c *ttlValueCtx) String() string {
+	return contextName(c.Context) + ".WithValueTTL(" +
+		keyString(c.key) + ", " +
+		stringify(c.val) + ", " +
+		c.ttl.String() + ")"
+}
+
+// ValueOr 取key对应的值。 存在并且是T类型就返回它。 不存在或者类型不对都返回def
+func ValueOr[T any](ctx Context, key any, def T) T {
+	if v, ok := ctx.Value(key).(T); ok {
+		return v
+	}
+	return def
+}
+
+// RequireValue 检查ctx里面一定有key对应的值。 没有就直接panic。 有的话原样返回ctx
+// 用来尽早发现接线的时候漏了WithValue
+func RequireValue(ctx Context, key any) Context {
+	ctx, err := RequireValueErr(ctx, key)
+	if err != nil {
+		panic(err.Error())
+	}
+	return ctx
+}
+
+// RequireValueErr 和RequireValue一样。 只是不panic。 返回错误
+func RequireValueErr(ctx Context, key any) (Context, error) {
+	if ctx.Value(key) == nil {
+		return ctx, errors.New("context: missing required value for key " + keyString(key) + " in " + contextName(ctx))
+	}
+	return ctx, nil
+}
+
+// StringKey 用字符串当key的时候用这个类型。 和直接拿string当key的区分开。 不会撞上
+type StringKey string
+
+// WithTaggedStruct 把结构体里带 ctx:"keyname" 标签的字段一个个存进ctx。 key是StringKey("keyname")
+// 所有字段放在一个节点里。 没标签的字段跳过。 v不是结构体或者结构体指针就panic
+func WithTaggedStruct(parent Context, v any) Context {
+	if parent == nil {
+		panic("cannot create context from nil parent")
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		panic("WithTaggedStruct: v is not a struct or a pointer to struct")
+	}
+	rt := rv.Type()
+	vals := make(map[any]any)
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		name, ok := f.Tag.Lookup("ctx")
+		if !ok || name == "" || !f.IsExported() {
+			continue
+		}
+		vals[StringKey(name)] = rv.Field(i).Interface()
+	}
+	return hooked(&valuesCtx{parent, vals, "WithTaggedStruct(" + rt.String() + ")"})
+}
+
+// valuesCtx 一个节点里存好几个值。 不用一个值挂一层
+type valuesCtx struct {
+	Context
+	vals map[any]any
+	desc string
+}
+
+// Value 存进来的key在WithValues里已经检查过了。 这里直接查map
+// 不能比较的key(切片 map 函数)拿去查map会panic。 这种key本来也不可能存进来。 直接往上找
+func (c *valuesCtx) Value(key any) any {
+	if key != nil && reflect.TypeOf(key).Comparable() {
+		if v, ok := c.vals[key]; ok {
+			hookLookup(c, key, true)
+			return v
+		}
+	}
+	return value(c.Context, key)
+}
+
+func (c *valuesCtx) String() string {
+	return contextName(c.Context) + "." + c.desc
+}
+
+// Key 带类型的key。 存进去取出来都是T。 不用自己再做类型断言
+// 直接声明一个变量就能用: var userKey context.Key[*User]
+// 用的是变量的地址当key。 所以两个Key变量就算名字一样也不会撞上
+type Key[T any] struct {
+	name string // only for printing, never compared
+}
+
+// NewKey 建一个有名字的Key。 名字只在打印的时候用
+func NewKey[T any](name string) *Key[T] {
+	return &Key[T]{name: name}
+}
+
+// WithValue 和WithValue(parent, k, v)一样。 只是v一定是T
+func (k *Key[T]) WithValue(parent Context, v T) Context {
+	return WithValue(parent, k, v)
+}
+
+// Value 取出k对应的值。 没存过返回T的零值和false
+func (k *Key[T]) Value(ctx Context) (T, bool) {
+	v, ok := ctx.Value(k).(T)
+	return v, ok
+}
+
+func (k *Key[T]) String() string {
+	if k.name != "" {
+		return k.name
+	}
+	var zero T
+	return "Key[" + reflect.TypeOf(&zero).Elem().String() + "]"
+}
+
+// 字符串key的驻留表。 同一个字符串永远拿到同一个key对象
+var internedKeys sync.Map // string -> *internedKey
+
+// InternKey 返回字符串s对应的唯一key
+// 两个地方各自用同一个字符串调InternKey。 拿到的是同一个指针。 所以Value能对得上
+func InternKey(s string) any {
+	if k, ok := internedKeys.Load(s); ok {
+		return k
+	}
+	k, _ := internedKeys.LoadOrStore(s, &internedKey{s})
+	return k
+}
+
+type internedKey struct{ name string }
+
+func (k *internedKey) String() string { return k.name }
+
+// key的登记表。 库可以把自己的key登记一下。 打印的时候就能显示个好名字
+var keyNames sync.Map // key -> string
+
+// RegisterKey 给key登记一个名字
+func RegisterKey(key any, name string) {
+	keyNames.Store(key, name)
+}
+
+// KeyName 查key登记过的名字
+func KeyName(key any) (string, bool) {
+	name, ok := keyNames.Load(key)
+	if !ok {
+		return "", false
+	}
+	return name.(string), true
+}
+
+// keyString 登记过就用登记的名字。 没登记就还是老办法
+func keyString(key any) string {
+	if name, ok := KeyName(key); ok {
+		return name
+	}
+	return stringify(key)
+}
+
+type valueCtx struct {
+	Context
+	key, val any
+}
+
+// stringify tries a bit to stringify v, without using fmt, since we don't
+// want context depending on the unicode tables. This is only used by
+// *valueCtx.String().
+func stringify(v any) string {
+	switch s := v.(type) {
+	case stringer:
+		return s.String()
+	case string:
+		return s
+	case nil:
+		return "<nil>"
+	}
+	return reflect.TypeOf(v).String()
+}
+
+func (c *valueCtx) String() string {
+	return contextName(c.Context) + ".WithValue(" +
+		keyString(c.key) + ", " +
+		stringify(c.val) + ")"
+}
+
+func (c *valueCtx) Value(key any) any {
+	// 对的上。就返回 存储的value
+	if c.key == key {
+		hookLookup(c, key, true)
+		return c.val
+	}
+	// 对不上就把各类型都试一遍。如果还是不是。就返回个空
+	return value(c.Context, key)
+}
+
+// value 沿着parent一路往上找
+// 只有 &cancelCtxKey 会被cancelCtx这些节点拦下来。 WithValue不允许用它当key。 所以用户的key不会被误拦
+func value(c Context, key any) any {
+	for {
+		switch ctx := c.(type) {
+		case *valueCtx:
+			if key == ctx.key {
+				hookLookup(c, key, true)
+				return ctx.val
+			}
+			c = ctx.Context
+		case *cancelCtx:
+			if key == &cancelCtxKey {
+				return c
+			}
+			if ValueCacheSize > 0 {
+				return ctx.cachedValue(key)
+			}
+			c = ctx.parent()
+		case withoutCancelCtx:
+			if key == &cancelCtxKey {
+				// This implements Cause(ctx) == nil
+				// when ctx is created using WithoutCancel.
+				return nil
+			}
+			c = ctx.c
+		case *nameCtx:
+			c = ctx.Context
+		case *timerCtx:
+			if key == &cancelCtxKey {
+				return &ctx.cancelCtx
+			}
+			if ValueCacheSize > 0 {
+				return ctx.cachedValue(key)
+			}
+			c = ctx.parent()
+		case backgroundCtx, todoCtx:
+			hookLookup(c, key, false)
+			return nil
+		default:
+			return c.Value(key)
+		}
+	}
+}
+
+// internalKey 包里自己用来往上找节点的key。 不是用户存的值
+// 过滤值的节点要放它们过去。 钩子也不报它们
+func internalKey(key any) bool {
+	return key == &cancelCtxKey || key == &logFieldsKey || key == &ackKey || key == &graceKey
+}
+
+// &logFieldsKey 是logFieldsCtx返回自己用的key。 和cancelCtxKey一个道理
+var logFieldsKey int
+
+// WithLogFields 往ctx里面放日志字段。 和WithValue不一样。 不是覆盖而是合并
+func WithLogFields(parent Context, fields map[string]any) Context {
+	if parent == nil {
+		panic("cannot create context from nil parent")
+	}
+	c := &logFieldsCtx{Context: parent, fields: make(map[string]any, len(fields))}
+	// 复制一份。 防止调用方之后再改这个map
+	for k, v := range fields {
+		c.fields[k] = v
+	}
+	// 记住上一层的日志字段节点。 LogFields的时候直接跳过去。 不用一个一个valueCtx去找
+	c.up, _ = parent.Value(&logFieldsKey).(*logFieldsCtx)
+	return hooked(c)
+}
+
+type logFieldsCtx struct {
+	Context
+	fields map[string]any
+	up     *logFieldsCtx
+}
+
+func (c *logFieldsCtx) Value(key any) any {
+	if key == &logFieldsKey {
+		return c
+	}
+	return value(c.Context, key)
+}
+
+func (c *logFieldsCtx) String() string {
+	return contextName(c.Context) + ".WithLogFields"
+}
+
+// LogFields 把从根到叶子所有的日志字段合成一个map。 key冲突的话越靠近叶子的越优先
+func LogFields(ctx Context) map[string]any {
+	var chain []*logFieldsCtx
+	for c, _ := ctx.Value(&logFieldsKey).(*logFieldsCtx); c != nil; c = c.up {
+		chain = append(chain, c)
+	}
+	fields := make(map[string]any)
+	// chain是从叶子到根的。 倒着合并。 叶子最后写。 所以叶子赢
+	for i := len(chain) - 1; i >= 0; i-- {
+		for k, v := range chain[i].fields {
+			fields[k] = v
+		}
+	}
+	return fields
+}
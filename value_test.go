@@ -0,0 +1,360 @@
+package context
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWithValues(t *testing.T) {
+	parent := WithValue(Background(), "up", 1)
+	ctx := WithValues(parent, "a", 1, "b", 2, "a", 3)
+	for _, tt := range []struct {
+		key  any
+		want any
+	}{
+		{"a", 3},
+		{"b", 2},
+		{"up", 1},
+		{"missing", nil},
+	} {
+		if got := ctx.Value(tt.key); got != tt.want {
+			t.Errorf("Value(%v) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+	if Cause(ctx) != nil {
+		t.Errorf("Cause = %v, want nil", Cause(ctx))
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("WithValues with a non-comparable key did not panic")
+		}
+	}()
+	WithValues(Background(), []int{1}, 1)
+}
+
+func TestWithValuesUnhashableLookup(t *testing.T) {
+	type config struct {
+		Region string `ctx:"region"`
+	}
+	// 和标准库一样。 拿不能比较的key来查返回nil。 不panic
+	for _, ctx := range []Context{
+		WithValues(Background(), "a", 1),
+		WithTaggedStruct(Background(), config{"cn-east"}),
+	} {
+		if got := ctx.Value([]int{1}); got != nil {
+			t.Errorf("%v.Value([]int{1}) = %v, want nil", ctx, got)
+		}
+	}
+}
+
+func TestPointerKeyNotIntercepted(t *testing.T) {
+	parent, cancel := WithCancel(Background())
+	defer cancel()
+
+	// 用*cancelCtx当key也只是普通的指针key
+	ctx := WithValue(parent, parent, "by ctx")
+	key := new(int)
+	ctx = WithValue(ctx, key, "by pointer")
+	child, cancelChild := WithCancel(ctx)
+	defer cancelChild()
+
+	if got := child.Value(parent); got != "by ctx" {
+		t.Errorf("Value(*cancelCtx key) = %v, want by ctx", got)
+	}
+	if got := child.Value(key); got != "by pointer" {
+		t.Errorf("Value(pointer key) = %v, want by pointer", got)
+	}
+	if got := child.Value(&cancelCtxKey); got != child {
+		t.Errorf("Value(&cancelCtxKey) = %v, want the child itself", got)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("WithValue(&cancelCtxKey) did not panic")
+		}
+	}()
+	WithValue(parent, &cancelCtxKey, 1)
+}
+
+func TestLogFieldsPrecedence(t *testing.T) {
+	ctx := WithLogFields(Background(), map[string]any{"a": 1, "b": 1, "c": 1})
+	ctx = WithValue(ctx, "unrelated", true)
+	ctx = WithLogFields(ctx, map[string]any{"b": 2, "c": 2})
+	ctx, cancel := WithCancel(ctx)
+	defer cancel()
+	ctx = WithLogFields(ctx, map[string]any{"c": 3, "d": 3})
+
+	got := LogFields(ctx)
+	want := map[string]any{"a": 1, "b": 2, "c": 3, "d": 3}
+	if len(got) != len(want) {
+		t.Fatalf("LogFields = %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("LogFields[%q] = %v, want %v", k, got[k], v)
+		}
+	}
+	if got := LogFields(Background()); len(got) != 0 {
+		t.Errorf("LogFields(Background()) = %v, want empty", got)
+	}
+}
+
+func TestInternKey(t *testing.T) {
+	a, b := InternKey("trace"), InternKey("trace")
+	if a != b {
+		t.Fatal("two InternKey(\"trace\") calls returned different keys")
+	}
+	ctx := WithValue(Background(), a, "id-1")
+	if got := ctx.Value(b); got != "id-1" {
+		t.Fatalf("Value(InternKey(\"trace\")) = %v, want id-1", got)
+	}
+	if ctx.Value(InternKey("span")) != nil || ctx.Value("trace") != nil {
+		t.Fatal("interned key matched a different key")
+	}
+}
+
+type registeredKey struct{}
+type unregisteredKey struct{}
+
+func TestRegisterKeyInDumpTree(t *testing.T) {
+	RegisterKey(registeredKey{}, "trace")
+	defer keyNames.Delete(registeredKey{})
+
+	ctx := WithValue(WithValue(Background(), registeredKey{}, 1), unregisteredKey{}, 2)
+	want := "context.Background\n" +
+		"  WithValue(trace, int)\n" +
+		"    WithValue(context.unregisteredKey, int) <-\n"
+	if got := DumpTree(ctx); got != want {
+		t.Fatalf("DumpTree =\n%s\nwant\n%s", got, want)
+	}
+	if name, ok := KeyName(unregisteredKey{}); ok {
+		t.Fatalf("KeyName(unregistered) = %q, true; want false", name)
+	}
+}
+
+func TestFilterValues(t *testing.T) {
+	parent, cancel := WithCancel(WithValues(Background(), "public", 1, "secret", 2))
+	ctx := FilterValues(parent, func(key any) bool { return key == "public" })
+	child, cancelChild := WithCancel(ctx)
+	defer cancelChild()
+
+	if got := child.Value("public"); got != 1 {
+		t.Errorf(`Value("public") = %v, want 1`, got)
+	}
+	if got := child.Value("secret"); got != nil {
+		t.Errorf(`Value("secret") = %v, want nil`, got)
+	}
+	cancel()
+	if err := child.Err(); err != Canceled {
+		t.Fatalf("child Err() = %v after parent cancel, want %v", err, Canceled)
+	}
+}
+
+func TestWithValueTTL(t *testing.T) {
+	parent := WithValue(Background(), "cred", "old")
+	ctx := WithValueTTL(parent, "cred", "new", 20*time.Millisecond)
+	if got := ctx.Value("cred"); got != "new" {
+		t.Fatalf(`Value("cred") = %v, want new`, got)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if got := ctx.Value("cred"); got != "old" {
+		t.Fatalf(`Value("cred") after the TTL = %v, want the parent's old`, got)
+	}
+	if got := WithValueTTL(Background(), "k", 1, time.Nanosecond).Value("k"); got != nil {
+		t.Fatalf(`expired Value("k") = %v, want nil`, got)
+	}
+}
+
+func TestValueOr(t *testing.T) {
+	ctx := WithValue(Background(), "port", 8080)
+	if got := ValueOr(ctx, "port", 80); got != 8080 {
+		t.Errorf("ValueOr(right type) = %v, want 8080", got)
+	}
+	if got := ValueOr(ctx, "port", "80"); got != "80" {
+		t.Errorf("ValueOr(wrong type) = %q, want %q", got, "80")
+	}
+	if got := ValueOr(ctx, "host", "localhost"); got != "localhost" {
+		t.Errorf("ValueOr(absent) = %q, want %q", got, "localhost")
+	}
+}
+
+func TestRequireValue(t *testing.T) {
+	ctx := WithValue(Background(), "user", "alice")
+	if got := RequireValue(ctx, "user"); got != ctx {
+		t.Errorf("RequireValue(present) = %v, want ctx unchanged", got)
+	}
+	if got, err := RequireValueErr(ctx, "user"); got != ctx || err != nil {
+		t.Errorf("RequireValueErr(present) = %v, %v, want ctx, nil", got, err)
+	}
+
+	if _, err := RequireValueErr(ctx, "tenant"); err == nil {
+		t.Error("RequireValueErr(absent) = nil error, want an error")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("RequireValue(absent) did not panic")
+		}
+	}()
+	RequireValue(ctx, "tenant")
+}
+
+func TestWithValueSelfReference(t *testing.T) {
+	parent, cancel := WithCancel(Background())
+	defer cancel()
+	other, cancelOther := WithCancel(Background())
+	defer cancelOther()
+	mid := WithValue(parent, "a", 1)
+
+	panics := func(val any) (panicked bool) {
+		defer func() { panicked = recover() != nil }()
+		WithValue(mid, "ctx", val)
+		return false
+	}
+	for _, tt := range []struct {
+		name string
+		val  any
+		want bool
+	}{
+		{"parent itself", mid, true},
+		{"ancestor", parent, true},
+		{"unrelated ctx", other, false},
+		{"Background", Background(), false},
+	} {
+		if got := panics(tt.val); got != tt.want {
+			t.Errorf("WithValue(mid, key, %s) panicked = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWithTaggedStruct(t *testing.T) {
+	type config struct {
+		Region  string `ctx:"region"`
+		Retries int    `ctx:"retries"`
+		Secret  string
+	}
+	ctx := WithTaggedStruct(Background(), &config{Region: "cn-east", Retries: 3, Secret: "s3cret"})
+	if got := ctx.Value(StringKey("region")); got != "cn-east" {
+		t.Errorf("Value(region) = %v, want cn-east", got)
+	}
+	if got := ctx.Value(StringKey("retries")); got != 3 {
+		t.Errorf("Value(retries) = %v, want 3", got)
+	}
+	// 没标签的不存。 普通的string key也撞不上
+	if got := ctx.Value(StringKey("Secret")); got != nil {
+		t.Errorf("Value(Secret) = %v, want nil", got)
+	}
+	if got := ctx.Value("region"); got != nil {
+		t.Errorf("Value(plain string key) = %v, want nil", got)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("WithTaggedStruct(non-struct) did not panic")
+		}
+	}()
+	WithTaggedStruct(Background(), 42)
+}
+
+func TestKey(t *testing.T) {
+	type user struct{ name string }
+	userKey := NewKey[*user]("user")
+	u := &user{"alice"}
+	ctx := userKey.WithValue(Background(), u)
+	if got, ok := userKey.Value(ctx); !ok || got != u {
+		t.Errorf("Value() = %v, %v, want %v, true", got, ok, u)
+	}
+	if got, ok := userKey.Value(Background()); ok || got != nil {
+		t.Errorf("Value() when absent = %v, %v, want nil, false", got, ok)
+	}
+
+	// 名字一样也是两个key
+	a, b := NewKey[int]("id"), NewKey[int]("id")
+	ctx = b.WithValue(a.WithValue(Background(), 1), 2)
+	if got, _ := a.Value(ctx); got != 1 {
+		t.Errorf("a.Value() = %d, want 1", got)
+	}
+	if got, _ := b.Value(ctx); got != 2 {
+		t.Errorf("b.Value() = %d, want 2", got)
+	}
+	// 零值的变量也能用
+	var plain Key[string]
+	ctx = plain.WithValue(ctx, "x")
+	if got, ok := plain.Value(ctx); !ok || got != "x" {
+		t.Errorf("zero Key Value() = %q, %v, want x, true", got, ok)
+	}
+	if got := plain.String(); got != "Key[string]" {
+		t.Errorf("String() = %q, want Key[string]", got)
+	}
+}
+
+func TestWithValueFunc(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	ctx := WithValueFunc(Background(), "session", func() any {
+		calls.Add(1)
+		<-release
+		return "s1"
+	})
+	// 建的时候 查别的key 打印 都不会去算
+	_ = ctx.Value("other")
+	_ = contextName(ctx)
+	if n := calls.Load(); n != 0 {
+		t.Fatalf("f ran %d times before the key was looked up, want 0", n)
+	}
+
+	// 好几个协程同时查。 只算一次。 都拿到同一个结果
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got := ctx.Value("session"); got != "s1" {
+				t.Errorf("Value() = %v, want s1", got)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	_ = ctx.Value("session")
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("f ran %d times, want 1", n)
+	}
+}
+
+func TestWithoutValue(t *testing.T) {
+	parent := WithValue(WithValue(Background(), "secret", "s3cret"), "user", "alice")
+	ctx := WithoutValue(parent, "secret")
+	if got := ctx.Value("secret"); got != nil {
+		t.Errorf("Value(secret) = %v, want nil", got)
+	}
+	if got := ctx.Value("user"); got != "alice" {
+		t.Errorf("Value(user) = %v, want alice", got)
+	}
+	// parent那边还在
+	if got := parent.Value("secret"); got != "s3cret" {
+		t.Errorf("parent Value(secret) = %v, want s3cret", got)
+	}
+	// 下面再存就又能查到了
+	if got := WithValue(ctx, "secret", "new").Value("secret"); got != "new" {
+		t.Errorf("Value(secret) after storing again = %v, want new", got)
+	}
+
+	// 快照里也没有
+	snap, cancel := Snapshot(ctx)
+	defer cancel()
+	if got := snap.Value("secret"); got != nil {
+		t.Errorf("Snapshot Value(secret) = %v, want nil", got)
+	}
+	if got := snap.Value("user"); got != "alice" {
+		t.Errorf("Snapshot Value(user) = %v, want alice", got)
+	}
+
+	// 藏起来也算盖住了上面的
+	if got := ShadowedKeys(ctx); len(got) != 1 || got[0] != "secret" {
+		t.Errorf("ShadowedKeys() = %v, want [secret]", got)
+	}
+}
@@ -0,0 +1,78 @@
+package context
+
+import (
+	"reflect"
+	"sync/atomic"
+)
+
+// ValueCacheSize 大于0的时候。 每个cancelCtx记住最近查过的这么多个key
+// logger trace id这种一个请求里要查几千次的key。 第一次往上找完了就记在cancelCtx上。 以后直接拿
+// 查不到(nil)也记。 链上有WithValueTTL(会过期)、Merge WithParents(有好几条链)或者别人自己实现的ctx的时候。 这个节点不缓存
+// Reparent会把链换掉。 所以每次Reparent都把代数加一。 记下来的时候不是这一代的整个不算
+// 换的是谁的parent不知道。 哪个节点下面都有可能。 WithoutCancel隔开的子孙也一样
+var ValueCacheSize int
+
+// reparentGen 每次Reparent加一。 缓存里记着是哪一代建的
+var reparentGen atomic.Uint64
+
+// valueCache 整个换掉。 不改里面。 读的时候不用加锁
+type valueCache struct {
+	off     bool   // the chain above can change its answers, never cache
+	gen     uint64 // reparentGen when the cache was started, stale once it moves on
+	entries []cacheEntry
+}
+
+type cacheEntry struct {
+	key, val any
+}
+
+// cachedValue 先看缓存。 没有再往上找。 找完了记下来
+func (c *cancelCtx) cachedValue(key any) any {
+	// 先读代数再往上找。 Reparent是先换parent再加代数的。 看到新的一代就一定看到新的parent
+	gen := reparentGen.Load()
+	vc := c.cache.Load()
+	if vc == nil || vc.gen != gen {
+		old := vc
+		vc = &valueCache{off: !cacheable(c.parent()), gen: gen}
+		c.cache.CompareAndSwap(old, vc)
+	}
+	size := ValueCacheSize
+	if vc.off || size <= 0 || key == &logFieldsKey {
+		return value(c.parent(), key)
+	}
+	// 存进来的key都能比较。 所以拿别的key来==不会panic
+	for _, e := range vc.entries {
+		if e.key == key {
+			hookLookup(c, key, e.val != nil)
+			return e.val
+		}
+	}
+	val := value(c.parent(), key)
+	if key == nil || !reflect.TypeOf(key).Comparable() {
+		return val
+	}
+	// 复制一份再换上去。 满了就把最老的挤掉。 和别人同时换的话输了就不记了。 下次再说
+	n := len(vc.entries)
+	if n >= size {
+		n = size - 1
+	}
+	entries := make([]cacheEntry, 0, n+1)
+	entries = append(entries, cacheEntry{key, val})
+	entries = append(entries, vc.entries[:n]...)
+	c.cache.CompareAndSwap(vc, &valueCache{gen: gen, entries: entries})
+	return val
+}
+
+// cacheable 从p一路往上看。 每个节点的答案是不是一直不变
+func cacheable(p Context) bool {
+	for ; p != nil; p = parentOf(p) {
+		switch p.(type) {
+		case backgroundCtx, todoCtx, emptyCtx:
+			return true
+		case *ttlValueCtx, *mergeCtx, *parentsCtx:
+			return false
+		}
+	}
+	// 别人自己实现的ctx。 parentOf看不穿
+	return false
+}
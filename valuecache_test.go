@@ -0,0 +1,31 @@
+package context
+
+import "testing"
+
+func TestValueCacheReparent(t *testing.T) {
+	ValueCacheSize = 8
+	defer func() { ValueCacheSize = 0 }()
+	pa, cancelA := WithCancel(WithValue(Background(), "k", "A"))
+	defer cancelA()
+	pb, cancelB := WithCancel(WithValue(Background(), "k", "B"))
+	defer cancelB()
+	mid, cancelMid := WithCancel(pa)
+	defer cancelMid()
+	// WithoutCancel隔开了。 leaf不在mid的children里。 但是查值照样经过mid
+	leaf, cancelLeaf := WithCancel(WithoutCancel(mid))
+	defer cancelLeaf()
+
+	if got := leaf.Value("k"); got != "A" {
+		t.Fatalf("Value before Reparent = %v, want A", got)
+	}
+	if !Reparent(mid, pb) {
+		t.Fatal("Reparent = false, want true")
+	}
+	if got := leaf.Value("k"); got != "B" {
+		t.Errorf("Value after Reparent = %v, want B", got)
+	}
+	// 新的一代照样能记
+	if got := leaf.Value("k"); got != "B" {
+		t.Errorf("cached Value after Reparent = %v, want B", got)
+	}
+}
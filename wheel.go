@@ -0,0 +1,152 @@
+package context
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SetTimerWheel 打开时间轮。 之后建的WithDeadline WithTimeout这一类的ctx不再一个ctx一个runtime timer
+// 而是都挂到一个时间轮上。 由一个协程每隔resolution转一格。 到点的一起取消
+// 到期最多晚resolution。 不会早。 resolution <= 0 就关掉。 关掉之前挂上去的照样会到点
+// 每秒要建几万个带超时的ctx的时候用。 精度要求高的不要开
+func SetTimerWheel(resolution time.Duration) {
+	if resolution <= 0 {
+		wheel.Store(nil)
+		return
+	}
+	wheel.Store(&timerWheel{res: resolution, start: time.Now()})
+}
+
+var wheel atomic.Pointer[timerWheel]
+
+// deadlineTimer timerCtx里面的定时器。 *time.Timer 和 *wheelTimer 都是
+type deadlineTimer interface {
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// afterFunc 开了时间轮就挂到时间轮上。 没开就是time.AfterFunc
+func afterFunc(d time.Duration, f func()) deadlineTimer {
+	if w := wheel.Load(); w != nil {
+		t := &wheelTimer{w: w, f: f}
+		t.Reset(d)
+		return t
+	}
+	return time.AfterFunc(d, f)
+}
+
+// wheelSlots 一圈多少格。 超过一圈的放在对应的格子里等下一圈
+const wheelSlots = 512
+
+// timerWheel 时间轮。 第n格代表 start+n*res 这个时刻
+// 没有定时器的时候协程就退出了。 不会空转
+type timerWheel struct {
+	res   time.Duration
+	start time.Time
+
+	mu      sync.Mutex
+	slots   [wheelSlots]map[*wheelTimer]struct{} // Under mu.
+	count   int                                  // timers in slots, under mu
+	done    int64                                // last tick already fired, under mu
+	running bool                                 // the tick goroutine is alive, under mu
+}
+
+type wheelTimer struct {
+	w    *timerWheel
+	f    func()
+	when int64 // tick to fire at, under w.mu
+	set  bool  // in the wheel, under w.mu
+}
+
+// Stop 和time.Timer的Stop一样。 停下来了返回true。 已经到点了或者已经停过了返回false
+func (t *wheelTimer) Stop() bool {
+	w := t.w
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !t.set {
+		return false
+	}
+	w.remove(t)
+	return true
+}
+
+// Reset 和time.Timer的Reset一样。 重新从现在开始计时。 之前还在等的话返回true
+func (t *wheelTimer) Reset(d time.Duration) bool {
+	w := t.w
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	was := t.set
+	if was {
+		w.remove(t)
+	}
+	since := time.Since(w.start)
+	if !w.running {
+		// 协程停过。 停的这段时间里没有定时器。 不用一格一格补
+		w.done = int64(since / w.res)
+	}
+	// d特别大的时候(比如离现在几百年的截止日期) 下面加起来会溢出成负数。 就马上到点了
+	// 封个顶。 反正也等不到那一天
+	if max := time.Duration(1<<63-1) - since - w.res; d > max {
+		d = max
+	}
+	// 向上取整。 宁可晚一点也不能早
+	t.when = int64((since + d + w.res - 1) / w.res)
+	if t.when <= w.done {
+		t.when = w.done + 1
+	}
+	s := &w.slots[t.when%wheelSlots]
+	if *s == nil {
+		*s = make(map[*wheelTimer]struct{})
+	}
+	(*s)[t] = struct{}{}
+	t.set = true
+	w.count++
+	if !w.running {
+		w.running = true
+		go w.run()
+	}
+	return was
+}
+
+// remove 调用前要持有w.mu
+func (w *timerWheel) remove(t *wheelTimer) {
+	delete(w.slots[t.when%wheelSlots], t)
+	t.set = false
+	w.count--
+}
+
+// run 每隔res转一格。 把转过的格子里到点的都拿出来。 放开锁之后交给别的协程去跑
+// ticker漏掉的格子也会补上
+func (w *timerWheel) run() {
+	ticker := time.NewTicker(w.res)
+	defer ticker.Stop()
+	for range ticker.C {
+		now := int64(time.Since(w.start) / w.res)
+		var fire []func()
+		w.mu.Lock()
+		for ; w.done < now; w.done++ {
+			tick := w.done + 1
+			for t := range w.slots[tick%wheelSlots] {
+				if t.when <= tick {
+					w.remove(t)
+					fire = append(fire, t.f)
+				}
+			}
+		}
+		stop := w.count == 0
+		if stop {
+			w.running = false
+		}
+		w.mu.Unlock()
+
+		// 和time.AfterFunc一样每个开一个协程跑。 取消的时候会跑AfterFuncSync的回调和钩子
+		// 在这个协程里跑的话。 一个慢的回调会把后面所有到点的都拖住
+		for _, f := range fire {
+			go f()
+		}
+		if stop {
+			return
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package context
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimerWheelSlowCallback(t *testing.T) {
+	SetTimerWheel(time.Millisecond)
+	defer SetTimerWheel(0)
+
+	slow, cancelSlow := WithTimeout(Background(), 5*time.Millisecond)
+	defer cancelSlow()
+	release := make(chan struct{})
+	defer close(release)
+	AfterFuncSync(slow, func() { <-release })
+
+	fast, cancelFast := WithTimeout(Background(), 10*time.Millisecond)
+	defer cancelFast()
+	select {
+	case <-fast.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("a blocked callback on one deadline held up another deadline")
+	}
+	if err := fast.Err(); err != DeadlineExceeded {
+		t.Fatalf("Err() = %v, want %v", err, DeadlineExceeded)
+	}
+}
+
+func TestTimerWheelFarDeadline(t *testing.T) {
+	SetTimerWheel(time.Millisecond)
+	defer SetTimerWheel(0)
+
+	ctx, cancel := WithDeadline(Background(), time.Unix(1<<62, 0))
+	defer cancel()
+	time.Sleep(10 * time.Millisecond)
+	if err := ctx.Err(); err != nil {
+		t.Fatalf("far-future deadline: Err() = %v, want nil", err)
+	}
+}
+
+func TestTimerWheelOrder(t *testing.T) {
+	SetTimerWheel(time.Millisecond)
+	defer SetTimerWheel(0)
+
+	// 倒着建。 到点的顺序要按截止日期来
+	fired := make(chan int, 3)
+	for i, d := range []time.Duration{60 * time.Millisecond, 30 * time.Millisecond, 5 * time.Millisecond} {
+		afterFunc(d, func() { fired <- i })
+	}
+	for _, want := range []int{2, 1, 0} {
+		select {
+		case got := <-fired:
+			if got != want {
+				t.Fatalf("fired timer %d, want %d", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timer %d never fired", want)
+		}
+	}
+}
+
+func TestTimerWheelStopReset(t *testing.T) {
+	SetTimerWheel(time.Millisecond)
+	defer SetTimerWheel(0)
+
+	fired := make(chan struct{}, 2)
+	timer := afterFunc(20*time.Millisecond, func() { fired <- struct{}{} })
+	if !timer.Stop() {
+		t.Fatal("Stop() on a pending timer = false, want true")
+	}
+	if timer.Stop() {
+		t.Fatal("second Stop() = true, want false")
+	}
+	time.Sleep(40 * time.Millisecond)
+	select {
+	case <-fired:
+		t.Fatal("stopped timer fired")
+	default:
+	}
+
+	// 停了之后Reset照样能用。 返回false因为之前没在等
+	if timer.Reset(5 * time.Millisecond) {
+		t.Fatal("Reset() after Stop = true, want false")
+	}
+	select {
+	case <-fired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("reset timer never fired")
+	}
+	// 响过了再Stop是false
+	if timer.Stop() {
+		t.Fatal("Stop() after fire = true, want false")
+	}
+
+	// 还在等的时候Reset往后推。 返回true。 原来的时间不会响
+	timer = afterFunc(10*time.Millisecond, func() { fired <- struct{}{} })
+	if !timer.Reset(time.Hour) {
+		t.Fatal("Reset() on a pending timer = false, want true")
+	}
+	time.Sleep(30 * time.Millisecond)
+	select {
+	case <-fired:
+		t.Fatal("timer fired at its old time after Reset")
+	default:
+	}
+	timer.Stop()
+}